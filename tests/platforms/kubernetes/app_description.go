@@ -5,6 +5,26 @@
 
 package kubernetes
 
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// WorkloadType is the kind of Kubernetes workload the test app is deployed as
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment deploys the test app as a Deployment
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet deploys the test app as a StatefulSet with stable pod identities and ordered startup
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+	// WorkloadTypeJob runs the test app to completion as a Job
+	WorkloadTypeJob WorkloadType = "Job"
+)
+
 // AppDescription holds the deployment information of test app
 type AppDescription struct {
 	AppName           string
@@ -28,4 +48,253 @@ type AppDescription struct {
 	DaprMemoryLimit   string
 	DaprMemoryRequest string
 	Namespace         *string
+	// SaveContainerLogsJSONL saves container logs as JSON lines annotated with pod, container and source
+	SaveContainerLogsJSONL bool
+	// AppID is the Dapr app ID set in the dapr.io/app-id annotation, defaults to AppName
+	AppID string
+	// WorkloadType is the kind of workload the app is deployed as, defaults to WorkloadTypeDeployment
+	WorkloadType WorkloadType
+	// MaxReplicas is the upper bound for scaling the app, defaults to 10
+	MaxReplicas int32
+	// ExtraPorts are container ports exposed by the app and its service in addition to the app port
+	ExtraPorts []int
+	// Ports replace the default http port and ExtraPorts of the app container when set. The service exposes
+	// each of them on the same port instead of exposing the app port on DefaultExternalPort.
+	Ports []AppPort
+	// LabelSelector is combined with the selector passed to GetPodsBySelector to find helper pods in the namespace
+	LabelSelector string
+	// InitContainers run to completion before the app starts, e.g. to wait for a dependency.
+	// Their images must be pullable from the cluster.
+	InitContainers []apiv1.Container
+	// AppEnvFromSecret maps app environment variable names to the secret keys holding their values
+	AppEnvFromSecret map[string]apiv1.SecretKeySelector
+	// AppEnvSecrets are the names of secrets whose keys are all exposed as app environment variables
+	AppEnvSecrets []string
+	// SaveContainerLogsManifest writes a JSON manifest describing the saved container logs, including failed ones
+	SaveContainerLogsManifest bool
+	// SaveContainerLogsArchive saves all container logs to a single <app>.logs.tar.gz file instead of a file
+	// per container, the manifest isn't written
+	SaveContainerLogsArchive bool
+	// SaveContainerLogsSnapshots suffixes the saved log files with a sequence number, e.g. testapp-pod.daprd.0002.log,
+	// so logs saved repeatedly during a long test don't overwrite each other
+	SaveContainerLogsSnapshots bool
+	// MaxContainerLogSnapshots is how many log snapshots are kept, older ones are deleted. 0 keeps all snapshots.
+	MaxContainerLogSnapshots int
+	// PodAnnotations are added to the pod template and override the annotations set from the other fields,
+	// e.g. dapr.io/log-level
+	PodAnnotations map[string]string
+	// PodLabels are added to the pod template, the testapp label can't be overridden
+	PodLabels map[string]string
+	// ServiceAccountName is the ServiceAccount the app pods run as, defaults to the namespace default
+	ServiceAccountName string
+	// ReadinessProbe is the readiness probe of the app container, no probe is set if nil
+	ReadinessProbe *apiv1.Probe
+	// LivenessProbe is the liveness probe of the app container, no probe is set if nil
+	LivenessProbe *apiv1.Probe
+	// ImagePullPolicy is the pull policy of the app image, defaults to Always.
+	// Use IfNotPresent for images loaded into local clusters such as kind or minikube.
+	ImagePullPolicy apiv1.PullPolicy
+	// ImagePullSecrets are the names of the secrets used to pull the app image from a private registry
+	ImagePullSecrets []string
+	// AppCommand overrides the entrypoint of the app image when set
+	AppCommand []string
+	// AppArgs overrides the arguments of the app image when set
+	AppArgs []string
+	// UDPPorts are UDP ports of the app. Port forwarding only supports TCP, so a socat relay container is added
+	// to the pod which PortForwardUDP tunnels the datagrams through. The tunnel doesn't keep datagram boundaries,
+	// so only send one datagram at a time through it and wait for its reply.
+	UDPPorts []int
+	// SidecarOptions configure the dapr side car, they take precedence over DaprCPULimit and the like
+	SidecarOptions SidecarOptions
+	// ExtraContainers are added to the app pods next to the app container, e.g. an auth proxy.
+	// Their logs are saved with the other containers.
+	ExtraContainers []apiv1.Container
+	// NodeSelector pins the app pods to nodes with these labels, e.g. a GPU node pool
+	NodeSelector map[string]string
+	// Tolerations allow the app pods to be scheduled onto tainted nodes
+	Tolerations []apiv1.Toleration
+	// SpreadAcrossNodes requires the app replicas to run on distinct nodes, replicas which don't fit stay pending
+	SpreadAcrossNodes bool
+	// Affinity replaces the default affinity, which pins the app pods to TargetOs and TargetArch
+	Affinity *apiv1.Affinity
+	// PriorityClassName is the PriorityClass of the app pods, e.g. for preemption tests
+	PriorityClassName string
+	// TerminationGracePeriodSeconds is how long the app pods may take to shut down after SIGTERM,
+	// defaults to the Kubernetes default of 30 seconds
+	TerminationGracePeriodSeconds *int64
+	// HostAliases are added to /etc/hosts of the app pods, e.g. to resolve an external test broker by hostname
+	HostAliases []apiv1.HostAlias
+	// DNSConfig adds nameservers, searches and options to the DNS config of the app pods
+	DNSConfig *apiv1.PodDNSConfig
+}
+
+// AppPort is a port of the app container
+type AppPort struct {
+	// Name defaults to port-<ContainerPort>, or udp-<ContainerPort> for UDP ports
+	Name          string
+	ContainerPort int
+	// Protocol defaults to TCP
+	Protocol apiv1.Protocol
+}
+
+// SidecarOptions are typed settings of the dapr side car which are translated into the dapr.io annotations
+// supported by the sidecar injector. Unset fields produce no annotation.
+type SidecarOptions struct {
+	CPULimit           string
+	CPURequest         string
+	MemoryLimit        string
+	MemoryRequest      string
+	LogLevel           string
+	LogAsJSON          *bool
+	EnableProfiling    *bool
+	AppMaxConcurrency  *int
+	HTTPMaxRequestSize *int
+}
+
+// AppOption sets a field of the AppDescription built by NewAppDescription
+type AppOption func(*AppDescription)
+
+// NewAppDescription builds the description of app name from opts. Dapr is enabled and one replica is deployed
+// unless opts say otherwise. The image is required, and the Dapr app ID must be a valid DNS label when Dapr is
+// enabled. AppDescription can still be used as a struct literal.
+func NewAppDescription(name string, opts ...AppOption) (AppDescription, error) {
+	app := AppDescription{
+		AppName:     name,
+		DaprEnabled: true,
+		Replicas:    1,
+	}
+	for _, opt := range opts {
+		opt(&app)
+	}
+
+	if err := validateAppDescription(app); err != nil {
+		return AppDescription{}, err
+	}
+
+	return app, nil
+}
+
+// validateAppDescription returns an error describing the first required field of app which is missing or invalid
+func validateAppDescription(app AppDescription) error {
+	if app.AppName == "" {
+		return fmt.Errorf("app name is required")
+	}
+	if app.ImageName == "" || app.RegistryName == "" {
+		return fmt.Errorf("image of %s is required", app.AppName)
+	}
+	if app.Replicas < 0 {
+		return fmt.Errorf("replicas of %s must not be negative", app.AppName)
+	}
+
+	if app.DaprEnabled {
+		appID := app.AppID
+		if appID == "" {
+			appID = app.AppName
+		}
+		if errs := validation.IsDNS1123Label(appID); len(errs) > 0 {
+			return fmt.Errorf("dapr app ID %q of %s is invalid: %s", appID, app.AppName, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
+}
+
+// WithImage sets the registry and name of the app image
+func WithImage(registry, image string) AppOption {
+	return func(app *AppDescription) {
+		app.RegistryName = registry
+		app.ImageName = image
+	}
+}
+
+// WithoutDapr deploys the app without the dapr side car
+func WithoutDapr() AppOption {
+	return func(app *AppDescription) {
+		app.DaprEnabled = false
+	}
+}
+
+// WithAppID sets the Dapr app ID, which defaults to the app name
+func WithAppID(appID string) AppOption {
+	return func(app *AppDescription) {
+		app.AppID = appID
+	}
+}
+
+// WithAppPort sets the port and protocol the app listens on
+func WithAppPort(port int, protocol string) AppOption {
+	return func(app *AppDescription) {
+		app.AppPort = port
+		app.AppProtocol = protocol
+	}
+}
+
+// WithReplicas sets the number of app replicas
+func WithReplicas(replicas int32) AppOption {
+	return func(app *AppDescription) {
+		app.Replicas = replicas
+	}
+}
+
+// WithIngress exposes the app through a LoadBalancer service
+func WithIngress() AppOption {
+	return func(app *AppDescription) {
+		app.IngressEnabled = true
+	}
+}
+
+// WithMetrics enables the metrics of the dapr side car
+func WithMetrics() AppOption {
+	return func(app *AppDescription) {
+		app.MetricsEnabled = true
+	}
+}
+
+// WithConfig sets the Dapr Configuration the side car loads
+func WithConfig(config string) AppOption {
+	return func(app *AppDescription) {
+		app.Config = config
+	}
+}
+
+// WithWorkloadType sets the kind of workload the app is deployed as
+func WithWorkloadType(workloadType WorkloadType) AppOption {
+	return func(app *AppDescription) {
+		app.WorkloadType = workloadType
+	}
+}
+
+// WithAppEnv adds an environment variable to the app container
+func WithAppEnv(name, value string) AppOption {
+	return func(app *AppDescription) {
+		if app.AppEnv == nil {
+			app.AppEnv = map[string]string{}
+		}
+		app.AppEnv[name] = value
+	}
+}
+
+// WithPodAnnotation adds an annotation to the app pods
+func WithPodAnnotation(key, value string) AppOption {
+	return func(app *AppDescription) {
+		if app.PodAnnotations == nil {
+			app.PodAnnotations = map[string]string{}
+		}
+		app.PodAnnotations[key] = value
+	}
+}
+
+// WithNodeSelector pins the app pods to nodes with these labels
+func WithNodeSelector(nodeSelector map[string]string) AppOption {
+	return func(app *AppDescription) {
+		app.NodeSelector = nodeSelector
+	}
+}
+
+// WithProbes sets the readiness and liveness probes of the app container, nil probes are not set
+func WithProbes(readiness, liveness *apiv1.Probe) AppOption {
+	return func(app *AppDescription) {
+		app.ReadinessProbe = readiness
+		app.LivenessProbe = liveness
+	}
 }
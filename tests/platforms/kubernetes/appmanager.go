@@ -6,19 +6,47 @@
 package kubernetes
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/wait"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 const (
@@ -36,8 +64,55 @@ const (
 	// PollTimeout is how long e2e tests will wait for resource updates when polling.
 	PollTimeout = 10 * time.Minute
 
-	// maxReplicas is the maximum replicas of replica sets
+	// maxReplicas is the default maximum replicas of replica sets, see AppDescription.MaxReplicas
 	maxReplicas = 10
+
+	// defaultCreateRetries is how many times creating a resource is retried on transient API server errors
+	defaultCreateRetries = 5
+	// defaultCreateRetryDelay is the initial delay between the retries, doubled on every attempt
+	defaultCreateRetryDelay = 500 * time.Millisecond
+
+	// diagnosticsTimeout is how long collecting failure diagnostics may take
+	diagnosticsTimeout = 10 * time.Second
+	// maxWarningEvents is the maximum number of warning events reported in failure diagnostics
+	maxWarningEvents = 10
+
+	// healthCheckRequestTimeout is the timeout of a single health check request
+	healthCheckRequestTimeout = 5 * time.Second
+
+	// defaultInvokeRetries is how many times InvokeMethod retries refused connections and 5xx responses
+	defaultInvokeRetries = 5
+	// defaultInvokeRetryDelay is the initial delay between the retries, doubled on every attempt
+	defaultInvokeRetryDelay = 500 * time.Millisecond
+	// invokeRequestTimeout is the timeout of a single service invocation request
+	invokeRequestTimeout = 30 * time.Second
+
+	// restartedAtAnnotation is the pod template annotation set by `kubectl rollout restart`
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	// deploymentRevisionAnnotation is the revision of a deployment and its ReplicaSets
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	// daprSystemConfigName is the Configuration of the dapr control plane which holds the mTLS settings
+	daprSystemConfigName = "daprsystem"
+
+	// maxLogWorkers is the maximum number of container logs downloaded concurrently
+	maxLogWorkers = 8
+
+	// maxLogLineSize is the longest container log line that is parsed when saving logs as JSON lines
+	maxLogLineSize = 1024 * 1024
+)
+
+// Timing steps reported to the timing collector, see WithTimingCollector
+const (
+	// TimingInit is the duration of Init
+	TimingInit = "init"
+	// TimingDeployCreate is the duration of the API calls creating the app workload
+	TimingDeployCreate = "deploy-create"
+	// TimingDeployReady is how long the app took to become ready after its workload was created
+	TimingDeployReady = "deploy-ready"
+	// TimingDisposeDelete is the duration of the API calls deleting the app resources
+	TimingDisposeDelete = "dispose-delete"
+	// TimingDisposeWait is how long the app resources took to be gone after they were deleted
+	TimingDisposeWait = "dispose-wait"
 )
 
 // AppManager holds Kubernetes clients and namespace used for test apps
@@ -50,12 +125,117 @@ type AppManager struct {
 	forwarder *PodPortForwarder
 
 	logPrefix string
+
+	// pollInterval and pollTimeout override PollInterval and PollTimeout when set
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+
+	// createRetries and createRetryDelay override defaultCreateRetries and defaultCreateRetryDelay when set
+	createRetries    int
+	createRetryDelay time.Duration
+
+	// createdNamespace is true if the namespace was created by this manager
+	createdNamespace bool
+	// namespaceCleanup deletes the namespace in Dispose if it was created by this manager
+	namespaceCleanup bool
+	// requireExistingNamespace makes Init fail instead of creating a missing namespace
+	requireExistingNamespace bool
+
+	// skipSidecarReadyWait makes Init return before the side cars are ready
+	skipSidecarReadyWait bool
+
+	// forceDeleteAfter is how long Dispose waits before force deleting the app pods, 0 never force deletes
+	forceDeleteAfter time.Duration
+
+	// metricsLocalPort is the local port forwarded to the side car metrics port, reused by GetSidecarMetrics
+	metricsLocalPort int
+	// invokeLocalPort is the local port forwarded to the side car HTTP port, reused by InvokeMethod
+	invokeLocalPort int
+
+	// invokeRetries overrides defaultInvokeRetries when set
+	invokeRetries int
+
+	// logSnapshot is the sequence number of the last container log snapshot, see SaveContainerLogsSnapshots
+	logSnapshot int
+	// logSnapshotFiles are the files saved by the kept log snapshots, oldest first
+	logSnapshotFiles [][]string
+
+	// timings are the durations of the last lifecycle steps
+	timings AppTimings
+	// timingCollector receives every recorded duration, if set
+	timingCollector func(step string, duration time.Duration)
+
+	// appliedResources are the resources applied by ApplyComponent, ApplyConfiguration and ApplyNetworkPolicy,
+	// deleted in Dispose
+	appliedResources []appliedResource
+
+	// variants are the apps deployed next to this app by DeployVariant, keyed by suffix
+	variants map[string]*AppManager
+
+	// lock guards app.Replicas, forwarder, logPrefix, metricsLocalPort, invokeLocalPort, variants, timings,
+	// the log snapshots and appliedResources which change after Init
+	lock sync.RWMutex
+}
+
+// DeploymentTimeoutError is returned when a deployment doesn't reach the desired state in time,
+// as opposed to an API error while reading it
+type DeploymentTimeoutError struct {
+	AppName string
+	// LastDeployment is the deployment observed last, nil if it was never read
+	LastDeployment *appsv1.Deployment
+	Elapsed        time.Duration
+	// Diagnostics describes failing conditions, init containers and warning events
+	Diagnostics string
+}
+
+func (e *DeploymentTimeoutError) Error() string {
+	var status interface{}
+	if e.LastDeployment != nil {
+		status = e.LastDeployment.Status
+	}
+	return fmt.Sprintf("deployment %q is not in desired state after %s, status: %+v: %s%s", e.AppName, e.Elapsed.Round(time.Millisecond), status, wait.ErrWaitTimeout, e.Diagnostics)
+}
+
+// Unwrap returns wait.ErrWaitTimeout
+func (e *DeploymentTimeoutError) Unwrap() error {
+	return wait.ErrWaitTimeout
+}
+
+// ServiceTimeoutError is returned when a service doesn't reach the desired state in time,
+// as opposed to an API error while reading it
+type ServiceTimeoutError struct {
+	AppName string
+	// LastService is the service observed last, nil if it was never read
+	LastService *apiv1.Service
+	Elapsed     time.Duration
+	// Diagnostics describes the load balancer state and service events
+	Diagnostics string
+}
+
+func (e *ServiceTimeoutError) Error() string {
+	return fmt.Sprintf("service %q is not in desired state after %s, received: %+v: %s%s", e.AppName, e.Elapsed.Round(time.Millisecond), e.LastService, wait.ErrWaitTimeout, e.Diagnostics)
+}
+
+// Unwrap returns wait.ErrWaitTimeout
+func (e *ServiceTimeoutError) Unwrap() error {
+	return wait.ErrWaitTimeout
+}
+
+// AppTimings are the durations of the last successful lifecycle steps of the app
+type AppTimings struct {
+	Init          time.Duration
+	DeployCreate  time.Duration
+	DeployReady   time.Duration
+	DisposeDelete time.Duration
+	DisposeWait   time.Duration
 }
 
 // PodInfo holds information about a given pod.
 type PodInfo struct {
 	Name string
 	IP   string
+	// NodeName is the node the pod is scheduled to, empty while it is pending
+	NodeName string
 }
 
 // NewAppManager creates AppManager instance
@@ -67,525 +247,4612 @@ func NewAppManager(kubeClients *KubeClient, namespace string, app AppDescription
 	}
 }
 
-// Name returns app name
-func (m *AppManager) Name() string {
-	return m.app.AppName
-}
-
-// App returns app description
-func (m *AppManager) App() AppDescription {
-	return m.app
+// WithPollConfig overrides how frequently and how long the app manager polls for resource updates.
+// A zero value keeps the package defaults PollInterval and PollTimeout.
+func (m *AppManager) WithPollConfig(interval, timeout time.Duration) *AppManager {
+	m.pollInterval = interval
+	m.pollTimeout = timeout
+	return m
 }
 
-// Init installs app by AppDescription
-func (m *AppManager) Init() error {
-	// Get or create test namespaces
-	if _, err := m.GetOrCreateNamespace(); err != nil {
-		return err
-	}
-
-	// TODO: Dispose app if option is required
-	if err := m.Dispose(true); err != nil {
-		return err
-	}
-
-	// Deploy app and wait until deployment is done
-	if _, err := m.Deploy(); err != nil {
-		return err
+// pollConfig returns the poll interval and timeout for the app, falling back to the package defaults
+func (m *AppManager) pollConfig() (time.Duration, time.Duration) {
+	interval := m.pollInterval
+	if interval <= 0 {
+		interval = PollInterval
 	}
 
-	// Wait until app is deployed completely
-	if _, err := m.WaitUntilDeploymentState(m.IsDeploymentDone); err != nil {
-		return err
+	timeout := m.pollTimeout
+	if timeout <= 0 {
+		timeout = PollTimeout
 	}
 
-	// Validate daprd side car is injected
-	if ok, err := m.ValidiateSideCar(); err != nil || ok != m.app.IngressEnabled {
-		return err
-	}
+	return interval, timeout
+}
 
-	// Create Ingress endpoint
-	if _, err := m.CreateIngressService(); err != nil {
-		return err
-	}
+// WaitUntil polls condition every interval until it returns true or an error, timeout elapses or ctx is done.
+// It returns wait.ErrWaitTimeout if the condition isn't met in time.
+func WaitUntil(ctx context.Context, condition func() (bool, error), interval, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	m.forwarder = NewPodPortForwarder(m.client, m.namespace)
+	return wait.PollImmediateUntil(interval, condition, ctx.Done())
+}
 
-	m.logPrefix = os.Getenv(ContainerLogPathEnvVar)
+// WaitUntilNoPods polls until no pods in namespace match labelSelector, e.g. to verify that the apps disposed
+// by a suite are gone before the next test starts. The error lists the remaining pods on timeout.
+func WaitUntilNoPods(client *KubeClient, namespace, labelSelector string, timeout time.Duration) error {
+	var remaining []string
+	waitErr := WaitUntil(context.Background(), func() (bool, error) {
+		podList, err := client.Pods(namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: labelSelector,
+		})
+		if err != nil {
+			return false, err
+		}
 
-	if m.logPrefix == "" {
-		m.logPrefix = ContainerLogDefaultPath
-	}
+		remaining = remaining[:0]
+		for _, pod := range podList.Items {
+			remaining = append(remaining, pod.Name)
+		}
+		return len(remaining) == 0, nil
+	}, PollInterval, timeout)
 
-	if err := os.MkdirAll(m.logPrefix, os.ModePerm); err != nil {
-		log.Printf("Failed to create output log directory '%s' Error was: '%s'. Container logs will be discarded", m.logPrefix, err)
-		m.logPrefix = ""
+	if waitErr == wait.ErrWaitTimeout {
+		return fmt.Errorf("pods matching %q in namespace %s are not deleted: %s: %w", labelSelector, namespace, strings.Join(remaining, ", "), waitErr)
 	}
 
-	return nil
+	return waitErr
 }
 
-// Dispose deletes deployment and service
-func (m *AppManager) Dispose(wait bool) error {
-	if m.logPrefix != "" {
-		if err := m.SaveContainerLogs(); err != nil {
-			log.Printf("Failed to retrieve container logs for %s. Error was: %s", m.app.AppName, err)
-		}
+// DeleteTestNamespaces deletes the namespaces created by the test run runID, e.g. namespaces leaked by a crashed run.
+// All namespaces created by the tests are deleted if runID is empty. Namespaces which existed before the tests
+// aren't labeled and are never deleted.
+func DeleteTestNamespaces(client *KubeClient, runID string) error {
+	selector := fmt.Sprintf("%s=true", TestNamespaceLabelKey)
+	if runID != "" {
+		selector = fmt.Sprintf("%s,%s=%s", selector, TestRunIDLabelKey, runID)
 	}
 
-	if err := m.DeleteDeployment(true); err != nil {
-		return err
-	}
-
-	if err := m.DeleteService(true); err != nil {
+	namespaceList, err := client.Namespaces().List(context.Background(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
 		return err
 	}
 
-	if wait {
-		if _, err := m.WaitUntilDeploymentState(m.IsDeploymentDeleted); err != nil {
-			return err
-		}
-
-		if _, err := m.WaitUntilServiceState(m.IsServiceDeleted); err != nil {
+	for _, namespace := range namespaceList.Items {
+		log.Printf("Deleting test namespace %s", namespace.Name)
+		err := client.Namespaces().Delete(context.Background(), namespace.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
 			return err
 		}
 	}
 
-	if m.forwarder != nil {
-		m.forwarder.Close()
-	}
-
 	return nil
 }
 
-// Deploy deploys app based on app description
-func (m *AppManager) Deploy() (*appsv1.Deployment, error) {
-	deploymentsClient := m.client.Deployments(m.namespace)
-	obj := buildDeploymentObject(m.namespace, m.app)
+// waitUntil polls condition with the poll interval and timeout of the app
+func (m *AppManager) waitUntil(ctx context.Context, condition func() (bool, error)) error {
+	interval, timeout := m.pollConfig()
+	return WaitUntil(ctx, condition, interval, timeout)
+}
 
-	result, err := deploymentsClient.Create(context.TODO(), obj, metav1.CreateOptions{})
-	if err != nil {
-		return nil, err
-	}
+// WithNamespaceCleanup makes Dispose delete the app namespace if this manager created it.
+// Namespaces which already existed are left alone.
+func (m *AppManager) WithNamespaceCleanup() *AppManager {
+	m.namespaceCleanup = true
+	return m
+}
 
-	return result, nil
+// WithRequireExistingNamespace makes Init return an error if the app namespace doesn't exist instead of
+// creating it, e.g. when CI pre-provisions namespaces with quotas and network policies
+func (m *AppManager) WithRequireExistingNamespace() *AppManager {
+	m.requireExistingNamespace = true
+	return m
 }
 
-// WaitUntilDeploymentState waits until isState returns true
-func (m *AppManager) WaitUntilDeploymentState(isState func(*appsv1.Deployment, error) bool) (*appsv1.Deployment, error) {
-	deploymentsClient := m.client.Deployments(m.namespace)
+// WithForceDeleteAfter makes Dispose force delete the app pods still terminating after grace, so teardown
+// completes on clusters where pods get stuck. Force deletions are logged. It's opt-in since it can hide
+// shutdown bugs of the app or the side car.
+func (m *AppManager) WithForceDeleteAfter(grace time.Duration) *AppManager {
+	m.forceDeleteAfter = grace
+	return m
+}
 
-	var lastDeployment *appsv1.Deployment
+// WithTimingCollector sets a function receiving the duration of every lifecycle step, e.g. to write them
+// to a CSV file or push them to a Prometheus pushgateway. The step is one of the Timing constants.
+// It is called synchronously and must not block.
+func (m *AppManager) WithTimingCollector(collector func(step string, duration time.Duration)) *AppManager {
+	m.timingCollector = collector
+	return m
+}
 
-	waitErr := wait.PollImmediate(PollInterval, PollTimeout, func() (bool, error) {
-		var err error
-		lastDeployment, err = deploymentsClient.Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
-		done := isState(lastDeployment, err)
-		if !done && err != nil {
-			return true, err
-		}
-		return done, nil
-	})
+// Timings returns the durations of the last successful lifecycle steps of the app
+func (m *AppManager) Timings() AppTimings {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 
-	if waitErr != nil {
-		return nil, fmt.Errorf("deployment %q is not in desired state, received: %+v: %s", m.app.AppName, lastDeployment, waitErr)
+	return m.timings
+}
+
+// recordTiming records the duration of step since start
+func (m *AppManager) recordTiming(step string, start time.Time) {
+	duration := time.Since(start)
+
+	m.lock.Lock()
+	switch step {
+	case TimingInit:
+		m.timings.Init = duration
+	case TimingDeployCreate:
+		m.timings.DeployCreate = duration
+	case TimingDeployReady:
+		m.timings.DeployReady = duration
+	case TimingDisposeDelete:
+		m.timings.DisposeDelete = duration
+	case TimingDisposeWait:
+		m.timings.DisposeWait = duration
 	}
+	m.lock.Unlock()
 
-	return lastDeployment, nil
+	if m.timingCollector != nil {
+		m.timingCollector(step, duration)
+	}
 }
 
-// IsDeploymentDone returns true if deployment object completes pod deployments
-func (m *AppManager) IsDeploymentDone(deployment *appsv1.Deployment, err error) bool {
-	return err == nil && deployment.Generation == deployment.Status.ObservedGeneration && deployment.Status.ReadyReplicas == m.app.Replicas && deployment.Status.AvailableReplicas == m.app.Replicas
+// WithInvokeRetries overrides how many times InvokeMethod retries refused connections and 5xx responses.
+// A zero value keeps the default.
+func (m *AppManager) WithInvokeRetries(retries int) *AppManager {
+	m.invokeRetries = retries
+	return m
 }
 
-// IsDeploymentDeleted returns true if deployment does not exist or current pod replica is zero
-func (m *AppManager) IsDeploymentDeleted(deployment *appsv1.Deployment, err error) bool {
-	return err != nil && errors.IsNotFound(err)
+// WithoutSidecarReadyWait makes Init return once the side car is injected without waiting until it is ready,
+// for tests which race the app startup on purpose
+func (m *AppManager) WithoutSidecarReadyWait() *AppManager {
+	m.skipSidecarReadyWait = true
+	return m
 }
 
-// ValidiateSideCar validates that dapr side car is running in dapr enabled pods
-func (m *AppManager) ValidiateSideCar() (bool, error) {
-	if !m.app.DaprEnabled {
-		return false, fmt.Errorf("dapr is not enabled for this app")
-	}
-
-	podClient := m.client.Pods(m.namespace)
+// WithCreateRetry overrides how many times and with which initial delay creating the app resources
+// is retried on transient API server errors. A zero value keeps the defaults.
+func (m *AppManager) WithCreateRetry(retries int, baseDelay time.Duration) *AppManager {
+	m.createRetries = retries
+	m.createRetryDelay = baseDelay
+	return m
+}
 
-	// Filter only 'testapp=appName' labeled Pods
-	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName),
-	})
-	if err != nil {
-		return false, err
+// createWithRetry calls create until it succeeds, fails with a non transient error or the retries run out
+func (m *AppManager) createWithRetry(create func() error) error {
+	retries := m.createRetries
+	if retries <= 0 {
+		retries = defaultCreateRetries
 	}
 
-	if len(podList.Items) != int(m.app.Replicas) {
-		return false, fmt.Errorf("expected number of pods for %s: %d, received: %d", m.app.AppName, m.app.Replicas, len(podList.Items))
+	delay := m.createRetryDelay
+	if delay <= 0 {
+		delay = defaultCreateRetryDelay
 	}
 
-	// Each pod must have daprd sidecar
-	for _, pod := range podList.Items {
-		daprdFound := false
-		for _, container := range pod.Spec.Containers {
-			if container.Name == DaprSideCarName {
-				daprdFound = true
-			}
+	var lastErr error
+	backoff := wait.Backoff{
+		Duration: delay,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    retries + 1,
+	}
+	waitErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		lastErr = create()
+		if lastErr == nil {
+			return true, nil
 		}
-		if !daprdFound {
-			return false, fmt.Errorf("cannot find dapr sidecar in pod %s", pod.Name)
+		if isTransientError(lastErr) {
+			log.Printf("Transient error creating resources for %s, retrying. Error was: %s", m.app.AppName, lastErr)
+			return false, nil
 		}
-	}
-
-	return true, nil
-}
-
-// DoPortForwarding performs port forwarding for given podname to access test apps in the cluster
-func (m *AppManager) DoPortForwarding(podName string, targetPorts ...int) ([]int, error) {
-	podClient := m.client.Pods(m.namespace)
-	// Filter only 'testapp=appName' labeled Pods
-	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName),
+		return false, lastErr
 	})
 
-	if err != nil {
-		return nil, err
+	if waitErr == wait.ErrWaitTimeout {
+		return lastErr
 	}
 
-	name := podName
+	return waitErr
+}
 
-	// if given pod name is empty , pick the first matching pod name
-	if name == "" {
-		for _, pod := range podList.Items {
-			name = pod.Name
-			break
-		}
-	}
+// isTransientError returns true if err is an API server error which is worth retrying
+func isTransientError(err error) bool {
+	return errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) ||
+		errors.IsInternalError(err) ||
+		errors.IsServiceUnavailable(err) ||
+		utilnet.IsConnectionRefused(err)
+}
 
-	return m.forwarder.Connect(name, targetPorts...)
+// Name returns app name
+func (m *AppManager) Name() string {
+	return m.app.AppName
 }
 
-// ScaleDeploymentReplica scales the deployment
-func (m *AppManager) ScaleDeploymentReplica(replicas int32) error {
-	if replicas < 0 || replicas > maxReplicas {
-		return fmt.Errorf("%d is out of range", replicas)
-	}
+// App returns app description
+func (m *AppManager) App() AppDescription {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 
-	deploymentsClient := m.client.Deployments(m.namespace)
+	return m.app
+}
 
-	scale, err := deploymentsClient.GetScale(context.TODO(), m.app.AppName, metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
+// replicas returns the current target number of replicas of the app
+func (m *AppManager) replicas() int32 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 
-	if scale.Spec.Replicas == replicas {
-		return nil
-	}
+	return m.app.Replicas
+}
+
+// setReplicas updates the target number of replicas of the app
+func (m *AppManager) setReplicas(replicas int32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	scale.Spec.Replicas = replicas
 	m.app.Replicas = replicas
+}
 
-	_, err = deploymentsClient.UpdateScale(context.TODO(), m.app.AppName, scale, metav1.UpdateOptions{})
+// portForwarder returns the port forwarder created by Init, or nil
+func (m *AppManager) portForwarder() *PodPortForwarder {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 
-	return err
+	return m.forwarder
 }
 
-// CreateIngressService creates Ingress endpoint for test app
-func (m *AppManager) CreateIngressService() (*apiv1.Service, error) {
-	serviceClient := m.client.Services(m.namespace)
-	obj := buildServiceObject(m.namespace, m.app)
-	result, err := serviceClient.Create(context.TODO(), obj, metav1.CreateOptions{})
-	if err != nil {
-		return nil, err
-	}
+// containerLogPrefix returns the directory container logs are saved to, or empty if logs are discarded
+func (m *AppManager) containerLogPrefix() string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 
-	return result, nil
+	return m.logPrefix
 }
 
-// AcquireExternalURL gets external ingress endpoint from service when it is ready
-func (m *AppManager) AcquireExternalURL() string {
-	log.Printf("Waiting until service ingress is ready for %s...\n", m.app.AppName)
-	svc, err := m.WaitUntilServiceState(m.IsServiceIngressReady)
-	if err != nil {
-		return ""
-	}
-
-	log.Printf("Service ingress for %s is ready...\n", m.app.AppName)
-	return m.AcquireExternalURLFromService(svc)
+// Init installs app by AppDescription
+//
+// Deprecated: use InitWithContext to propagate test deadlines and cancellation.
+func (m *AppManager) Init() error {
+	return m.InitWithContext(context.Background())
 }
 
-// WaitUntilServiceState waits until isState returns true
-func (m *AppManager) WaitUntilServiceState(isState func(*apiv1.Service, error) bool) (*apiv1.Service, error) {
-	serviceClient := m.client.Services(m.namespace)
-	var lastService *apiv1.Service
+// InitWithContext installs app by AppDescription
+func (m *AppManager) InitWithContext(ctx context.Context) error {
+	if err := m.validateAppID(); err != nil {
+		return err
+	}
 
-	waitErr := wait.PollImmediate(PollInterval, PollTimeout, func() (bool, error) {
-		var err error
-		lastService, err = serviceClient.Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
-		done := isState(lastService, err)
-		if !done && err != nil {
-			return true, err
+	start := time.Now()
+
+	// Get or create test namespaces
+	if m.requireExistingNamespace {
+		if err := m.requireNamespace(ctx); err != nil {
+			return err
 		}
+	} else if _, err := m.getOrCreateNamespace(ctx); err != nil {
+		return err
+	}
 
-		return done, nil
-	})
+	// TODO: Dispose app if option is required
+	if err := m.disposeApp(ctx, true, true); err != nil {
+		return err
+	}
 
-	if waitErr != nil {
-		return lastService, fmt.Errorf("service %q is not in desired state, received: %+v: %s", m.app.AppName, lastService, waitErr)
+	// Deploy app and wait until deployment is done
+	if _, err := m.DeployWithContext(ctx); err != nil {
+		return err
 	}
+	readyStart := time.Now()
 
-	return lastService, nil
-}
+	// Wait until app is deployed completely
+	if err := m.WaitUntilWorkloadReady(ctx); err != nil {
+		return err
+	}
 
-// AcquireExternalURLFromService gets external url from Service Object.
-func (m *AppManager) AcquireExternalURLFromService(svc *apiv1.Service) string {
-	if svc.Status.LoadBalancer.Ingress != nil && len(svc.Status.LoadBalancer.Ingress) > 0 && len(svc.Spec.Ports) > 0 {
-		address := ""
-		if svc.Status.LoadBalancer.Ingress[0].Hostname != "" {
-			address = svc.Status.LoadBalancer.Ingress[0].Hostname
-		} else {
-			address = svc.Status.LoadBalancer.Ingress[0].IP
+	if m.app.DaprEnabled {
+		// Validate daprd side car is injected
+		if _, err := m.validateSideCar(ctx); err != nil {
+			return err
+		}
+
+		// Wait until daprd is connected to the control plane
+		if !m.skipSidecarReadyWait {
+			if err := m.WaitUntilSidecarReady(ctx); err != nil {
+				return err
+			}
 		}
-		return fmt.Sprintf("%s:%d", address, svc.Spec.Ports[0].Port)
 	}
+	m.recordTiming(TimingDeployReady, readyStart)
 
-	// TODO: Support the other local k8s clusters
-	if minikubeExternalIP := m.minikubeNodeIP(); minikubeExternalIP != "" {
-		// if test cluster is minikube, external ip address is minikube node address
-		if len(svc.Spec.Ports) > 0 {
-			return fmt.Sprintf("%s:%d", minikubeExternalIP, svc.Spec.Ports[0].NodePort)
+	// Dapr apps without ingress are only reached through their side cars, so they get no service or forwarder
+	var forwarder *PodPortForwarder
+	if !m.app.DaprEnabled || m.app.IngressEnabled {
+		// Create Ingress endpoint
+		if _, err := m.createIngressService(ctx); err != nil {
+			return err
 		}
+
+		forwarder = NewPodPortForwarder(m.client, m.namespace)
 	}
 
-	return ""
-}
+	logPrefix := os.Getenv(ContainerLogPathEnvVar)
 
-// IsServiceIngressReady returns true if external ip is available
-func (m *AppManager) IsServiceIngressReady(svc *apiv1.Service, err error) bool {
+	if logPrefix == "" {
+		logPrefix = ContainerLogDefaultPath
+	}
+
+	if err := os.MkdirAll(logPrefix, os.ModePerm); err != nil {
+		log.Printf("Failed to create output log directory '%s' Error was: '%s'. Container logs will be discarded", logPrefix, err)
+		logPrefix = ""
+	}
+
+	m.lock.Lock()
+	m.forwarder = forwarder
+	m.logPrefix = logPrefix
+	m.lock.Unlock()
+
+	m.recordTiming(TimingInit, start)
+
+	return nil
+}
+
+// Reset deletes and recreates the app workload and service and waits until the app is ready again, which is
+// faster than Dispose and Init. The namespace and its other resources such as components and secrets are kept.
+// Active port forwards are established again on the same local ports, to the pod with the same name if it
+// still exists (StatefulSets) or the first app pod otherwise. Local ports taken in the meantime are remapped.
+func (m *AppManager) Reset() error {
+	return m.ResetWithContext(context.Background())
+}
+
+// ResetWithContext is Reset with a context to propagate test deadlines and cancellation
+func (m *AppManager) ResetWithContext(ctx context.Context) error {
+	var forwards []portForward
+	if forwarder := m.portForwarder(); forwarder != nil {
+		forwards = forwarder.tcpForwards()
+		forwarder.Close()
+	}
+	m.lock.Lock()
+	m.metricsLocalPort = 0
+	m.invokeLocalPort = 0
+	m.lock.Unlock()
+
+	if err := m.deleteWorkload(ctx); err != nil {
+		return err
+	}
+	if err := m.deleteService(ctx, true); err != nil {
+		return err
+	}
+	if err := m.waitUntilWorkloadDeleted(ctx); err != nil {
+		return err
+	}
+	if _, err := m.WaitUntilServiceStateWithContext(ctx, m.IsServiceDeleted); err != nil {
+		return err
+	}
+
+	if _, err := m.DeployWithContext(ctx); err != nil {
+		return err
+	}
+	if err := m.WaitUntilWorkloadReady(ctx); err != nil {
+		return err
+	}
+	if m.app.DaprEnabled {
+		if _, err := m.validateSideCar(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := m.createIngressService(ctx); err != nil {
+		return err
+	}
+
+	// Pod names change, so the forwarder is replaced
+	forwarder := NewPodPortForwarder(m.client, m.namespace)
+	m.lock.Lock()
+	m.forwarder = forwarder
+	m.lock.Unlock()
+
+	if len(forwards) == 0 {
+		return nil
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(podList.Items) == 0 {
+		return fmt.Errorf("no pods found for %s to forward ports to", m.app.AppName)
+	}
+
+	for _, forward := range forwards {
+		podName := podList.Items[0].Name
+		for _, pod := range podList.Items {
+			if pod.Name == forward.podName {
+				podName = pod.Name
+				break
+			}
+		}
+		if err := forwarder.reconnect(podName, forward); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Dispose deletes deployment and service
+//
+// Deprecated: use DisposeWithContext to propagate test deadlines and cancellation.
+func (m *AppManager) Dispose(wait bool) error {
+	return m.DisposeWithContext(context.Background(), wait)
+}
+
+// DisposeWithContext deletes deployment and service, and the namespace if namespace cleanup is enabled
+func (m *AppManager) DisposeWithContext(ctx context.Context, wait bool) error {
+	return m.dispose(ctx, wait, true)
+}
+
+// DisposeWithoutLogs deletes deployment and service like Dispose, but skips saving container logs.
+// This speeds up the teardown of passing tests; use Dispose on failure since the logs are lost otherwise.
+func (m *AppManager) DisposeWithoutLogs(wait bool) error {
+	return m.DisposeWithoutLogsWithContext(context.Background(), wait)
+}
+
+// DisposeWithoutLogsWithContext is DisposeWithContext without saving container logs
+func (m *AppManager) DisposeWithoutLogsWithContext(ctx context.Context, wait bool) error {
+	return m.dispose(ctx, wait, false)
+}
+
+func (m *AppManager) dispose(ctx context.Context, wait bool, saveLogs bool) error {
+	if err := m.disposeApp(ctx, wait, saveLogs); err != nil {
+		return err
+	}
+
+	// Applied resources and quotas survive the cleanup in Init, so they are only deleted here
+	if err := m.deleteAppliedResources(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deleteResourceQuota(ctx); err != nil {
+		return err
+	}
+
+	if m.namespaceCleanup && m.createdNamespace {
+		return m.deleteNamespace(ctx, wait)
+	}
+
+	return nil
+}
+
+// disposeApp deletes deployment and service, leaving the namespace in place
+func (m *AppManager) disposeApp(ctx context.Context, wait bool, saveLogs bool) error {
+	if saveLogs && m.containerLogPrefix() != "" {
+		if err := m.saveContainerLogs(ctx); err != nil {
+			log.Printf("Failed to retrieve container logs for %s. Error was: %s", m.app.AppName, err)
+		}
+	}
+
+	deleteStart := time.Now()
+
+	if err := m.disposeVariants(ctx, wait, saveLogs); err != nil {
+		return err
+	}
+
+	if err := m.deleteHPA(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deletePDB(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deleteWorkload(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deleteService(ctx, true); err != nil {
+		return err
+	}
+	m.recordTiming(TimingDisposeDelete, deleteStart)
+
+	if wait {
+		waitStart := time.Now()
+		if err := m.waitUntilWorkloadDeletedOrForce(ctx); err != nil {
+			return err
+		}
+
+		if _, err := m.WaitUntilServiceStateWithContext(ctx, m.IsServiceDeleted); err != nil {
+			return err
+		}
+		m.recordTiming(TimingDisposeWait, waitStart)
+	}
+
+	if forwarder := m.portForwarder(); forwarder != nil {
+		forwarder.Close()
+	}
+	m.lock.Lock()
+	m.metricsLocalPort = 0
+	m.invokeLocalPort = 0
+	m.lock.Unlock()
+
+	return nil
+}
+
+// appliedResource is a resource applied from YAML by the app manager
+type appliedResource struct {
+	resource schema.GroupVersionResource
+	name     string
+}
+
+var (
+	// daprComponentsResource is the resource of Dapr components
+	daprComponentsResource = schema.GroupVersionResource{Group: "dapr.io", Version: "v1alpha1", Resource: "components"}
+	// daprConfigurationsResource is the resource of Dapr configurations
+	daprConfigurationsResource = schema.GroupVersionResource{Group: "dapr.io", Version: "v1alpha1", Resource: "configurations"}
+	// networkPoliciesResource is the resource of Kubernetes network policies
+	networkPoliciesResource = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+)
+
+// ApplyComponent creates or updates the Dapr Component given as YAML in the app namespace, unless the YAML sets
+// another namespace. Apply components before Init so the side car loads them on startup. Dispose deletes the
+// components applied by the app manager.
+func (m *AppManager) ApplyComponent(yaml []byte) error {
+	return m.applyResource(context.TODO(), yaml, "Component", daprComponentsResource)
+}
+
+// DeleteComponent deletes the Dapr Component name from the app namespace
+func (m *AppManager) DeleteComponent(name string) error {
+	return m.deleteResource(context.TODO(), daprComponentsResource, name)
+}
+
+// ApplyConfiguration creates or updates the Dapr Configuration given as YAML in the app namespace, unless the YAML
+// sets another namespace. Apply configurations before Deploy, the side car reads the configuration named by the
+// dapr.io/config annotation only on startup. Dispose deletes the configurations applied by the app manager.
+func (m *AppManager) ApplyConfiguration(yaml []byte) error {
+	return m.applyResource(context.TODO(), yaml, "Configuration", daprConfigurationsResource)
+}
+
+// DeleteConfiguration deletes the Dapr Configuration name from the app namespace
+func (m *AppManager) DeleteConfiguration(name string) error {
+	return m.deleteResource(context.TODO(), daprConfigurationsResource, name)
+}
+
+// ApplyNetworkPolicy creates or updates the NetworkPolicy given as YAML in the app namespace, unless the YAML sets
+// another namespace, e.g. to assert that denying egress breaks service invocation. Dispose deletes the policies
+// applied by the app manager.
+func (m *AppManager) ApplyNetworkPolicy(yaml []byte) error {
+	return m.applyResource(context.TODO(), yaml, "NetworkPolicy", networkPoliciesResource)
+}
+
+// DeleteNetworkPolicy deletes the NetworkPolicy name from the app namespace
+func (m *AppManager) DeleteNetworkPolicy(name string) error {
+	return m.deleteResource(context.TODO(), networkPoliciesResource, name)
+}
+
+// applyResource creates or updates the resource of kind given as YAML and tracks it for Dispose
+func (m *AppManager) applyResource(ctx context.Context, data []byte, kind string, resource schema.GroupVersionResource) error {
+	obj := &unstructured.Unstructured{}
+	if err := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(&obj.Object); err != nil {
+		return fmt.Errorf("failed to parse %s: %s", kind, err)
+	}
+	if obj.GetKind() != kind {
+		return fmt.Errorf("expected a %s, got kind %q", kind, obj.GetKind())
+	}
+	if obj.GetName() == "" {
+		return fmt.Errorf("%s has no name", kind)
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(m.namespace)
+	}
+
+	client := m.client.DynamicClient.Resource(resource).Namespace(obj.GetNamespace())
+	err := m.createWithRetry(func() error {
+		_, err := client.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	})
+	if errors.IsAlreadyExists(err) {
+		var existing *unstructured.Unstructured
+		existing, err = client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err == nil {
+			obj.SetResourceVersion(existing.GetResourceVersion())
+			_, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s: %s", kind, obj.GetName(), err)
+	}
+
+	if obj.GetNamespace() != m.namespace {
+		// Resources in other namespaces may be shared, so they are left alone in Dispose
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, applied := range m.appliedResources {
+		if applied.resource == resource && applied.name == obj.GetName() {
+			return nil
+		}
+	}
+	m.appliedResources = append(m.appliedResources, appliedResource{resource: resource, name: obj.GetName()})
+
+	return nil
+}
+
+// deleteResource deletes the resource name from the app namespace and stops tracking it
+func (m *AppManager) deleteResource(ctx context.Context, resource schema.GroupVersionResource, name string) error {
+	err := m.client.DynamicClient.Resource(resource).Namespace(m.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i, applied := range m.appliedResources {
+		if applied.resource == resource && applied.name == name {
+			m.appliedResources = append(m.appliedResources[:i], m.appliedResources[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// deleteAppliedResources deletes the resources applied by the app manager, last applied first
+func (m *AppManager) deleteAppliedResources(ctx context.Context) error {
+	m.lock.RLock()
+	applied := append([]appliedResource{}, m.appliedResources...)
+	m.lock.RUnlock()
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := m.deleteResource(ctx, applied[i].resource, applied[i].name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deploy deploys app based on app description
+//
+// Deprecated: use DeployWithContext to propagate test deadlines and cancellation.
+func (m *AppManager) Deploy() (*appsv1.Deployment, error) {
+	return m.DeployWithContext(context.Background())
+}
+
+// DeployWithContext deploys app based on app description.
+// Apps with WorkloadTypeStatefulSet are deployed as a StatefulSet and the returned Deployment is nil,
+// use DeployStatefulSetWithContext to get the created StatefulSet.
+func (m *AppManager) DeployWithContext(ctx context.Context) (*appsv1.Deployment, error) {
+	start := time.Now()
+	deployment, err := m.deployWorkload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.recordTiming(TimingDeployCreate, start)
+
+	return deployment, nil
+}
+
+// deployWorkload creates the app workload of the configured type
+func (m *AppManager) deployWorkload(ctx context.Context) (*appsv1.Deployment, error) {
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		_, err := m.DeployStatefulSetWithContext(ctx)
+		return nil, err
+	case WorkloadTypeJob:
+		_, err := m.DeployJobWithContext(ctx)
+		return nil, err
+	}
+
+	deploymentsClient := m.client.Deployments(m.namespace)
+	obj := buildDeploymentObject(m.namespace, m.App())
+
+	var result *appsv1.Deployment
+	err := m.createWithRetry(func() error {
+		var err error
+		result, err = deploymentsClient.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeployAndWait deploys the app, waits until it is ready and, if Dapr is enabled, validates that the
+// side car is injected into every pod. The returned Deployment is nil for other workload types.
+func (m *AppManager) DeployAndWait(ctx context.Context) (*appsv1.Deployment, error) {
+	if _, err := m.DeployWithContext(ctx); err != nil {
+		return nil, err
+	}
+	readyStart := time.Now()
+
+	var deployment *appsv1.Deployment
+	if m.app.WorkloadType == "" || m.app.WorkloadType == WorkloadTypeDeployment {
+		var err error
+		deployment, err = m.WaitUntilDeploymentStateWithContext(ctx, m.IsDeploymentDone)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := m.WaitUntilWorkloadReady(ctx); err != nil {
+		return nil, err
+	}
+
+	if m.app.DaprEnabled {
+		if _, err := m.validateSideCar(ctx); err != nil {
+			return nil, err
+		}
+	}
+	m.recordTiming(TimingDeployReady, readyStart)
+
+	return deployment, nil
+}
+
+// DeployVariant deploys a second version of the app, e.g. for canary tests, and returns the manager of the variant.
+// The variant's workload and service are named after the app with the suffix appended and it is disposed with
+// the app. The variant's Dapr app ID defaults to its own name, set app.AppID to share the app ID with the app.
+func (m *AppManager) DeployVariant(suffix string, app AppDescription) (*AppManager, error) {
+	return m.DeployVariantWithContext(context.Background(), suffix, app)
+}
+
+// DeployVariantWithContext is DeployVariant with a context to propagate test deadlines and cancellation
+func (m *AppManager) DeployVariantWithContext(ctx context.Context, suffix string, app AppDescription) (*AppManager, error) {
+	if suffix == "" {
+		return nil, fmt.Errorf("variant suffix of %s must not be empty", m.app.AppName)
+	}
+	if m.Variant(suffix) != nil {
+		return nil, fmt.Errorf("variant %q of %s is already deployed", suffix, m.app.AppName)
+	}
+
+	app.AppName = m.app.AppName + "-" + suffix
+	variant := NewAppManager(m.client, m.namespace, app).
+		WithPollConfig(m.pollInterval, m.pollTimeout).
+		WithCreateRetry(m.createRetries, m.createRetryDelay)
+
+	if err := variant.disposeApp(ctx, true, false); err != nil {
+		return nil, err
+	}
+	if _, err := variant.DeployAndWait(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := variant.createIngressService(ctx); err != nil {
+		return nil, err
+	}
+
+	forwarder := NewPodPortForwarder(m.client, m.namespace)
+	variant.lock.Lock()
+	variant.forwarder = forwarder
+	variant.logPrefix = m.containerLogPrefix()
+	variant.lock.Unlock()
+
+	m.lock.Lock()
+	if m.variants == nil {
+		m.variants = map[string]*AppManager{}
+	}
+	m.variants[suffix] = variant
+	m.lock.Unlock()
+
+	return variant, nil
+}
+
+// Variant returns the manager of the variant deployed with suffix, or nil if there is none.
+// Its helpers, e.g. for logs, scaling and URLs, target the variant instead of the app.
+func (m *AppManager) Variant(suffix string) *AppManager {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.variants[suffix]
+}
+
+// disposeVariants disposes the variants deployed by DeployVariant
+func (m *AppManager) disposeVariants(ctx context.Context, wait bool, saveLogs bool) error {
+	m.lock.Lock()
+	variants := m.variants
+	m.variants = nil
+	m.lock.Unlock()
+
+	for _, variant := range variants {
+		if err := variant.disposeApp(ctx, wait, saveLogs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeployJobWithContext deploys app as a Job based on app description
+func (m *AppManager) DeployJobWithContext(ctx context.Context) (*batchv1.Job, error) {
+	jobsClient := m.client.Jobs(m.namespace)
+	obj := buildJobObject(m.namespace, m.App())
+
+	var result *batchv1.Job
+	err := m.createWithRetry(func() error {
+		var err error
+		result, err = jobsClient.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeployStatefulSetWithContext deploys app as a StatefulSet based on app description
+func (m *AppManager) DeployStatefulSetWithContext(ctx context.Context) (*appsv1.StatefulSet, error) {
+	statefulSetsClient := m.client.StatefulSets(m.namespace)
+	obj := buildStatefulSetObject(m.namespace, m.App())
+
+	var result *appsv1.StatefulSet
+	err := m.createWithRetry(func() error {
+		var err error
+		result, err = statefulSetsClient.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isStatefulSet returns true if the app is deployed as a StatefulSet
+func (m *AppManager) isStatefulSet() bool {
+	return m.app.WorkloadType == WorkloadTypeStatefulSet
+}
+
+// WaitUntilWorkloadReady waits until the app's Deployment or StatefulSet has all replicas ready,
+// or the app's Job has started its pods
+func (m *AppManager) WaitUntilWorkloadReady(ctx context.Context) error {
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		_, err := m.WaitUntilStatefulSetStateWithContext(ctx, m.IsStatefulSetDone)
+		return err
+	case WorkloadTypeJob:
+		_, err := m.waitUntilJobState(ctx, func(job *batchv1.Job, err error) bool {
+			return err == nil && job.Status.Active+job.Status.Succeeded+job.Status.Failed > 0
+		})
+		return err
+	}
+
+	_, err := m.WaitUntilDeploymentStateWithContext(ctx, m.IsDeploymentDone)
+	return err
+}
+
+// deleteWorkload deletes the app's Deployment, StatefulSet or Job
+func (m *AppManager) deleteWorkload(ctx context.Context) error {
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		return m.deleteStatefulSet(ctx, true)
+	case WorkloadTypeJob:
+		return m.deleteJob(ctx, true)
+	}
+
+	return m.deleteDeployment(ctx, true)
+}
+
+// waitUntilWorkloadDeleted waits until the app's Deployment, StatefulSet or Job is gone
+func (m *AppManager) waitUntilWorkloadDeleted(ctx context.Context) error {
+	var err error
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		_, err = m.WaitUntilStatefulSetStateWithContext(ctx, m.IsStatefulSetDeleted)
+	case WorkloadTypeJob:
+		_, err = m.waitUntilJobState(ctx, func(job *batchv1.Job, err error) bool {
+			return err != nil && errors.IsNotFound(err)
+		})
+	default:
+		_, err = m.WaitUntilDeploymentStateWithContext(ctx, m.IsDeploymentDeleted)
+	}
+
+	return err
+}
+
+// waitUntilWorkloadDeletedOrForce waits until the app's workload is gone, force deleting the remaining app pods
+// once forceDeleteAfter has elapsed if it is set
+func (m *AppManager) waitUntilWorkloadDeletedOrForce(ctx context.Context) error {
+	if m.forceDeleteAfter <= 0 {
+		return m.waitUntilWorkloadDeleted(ctx)
+	}
+
+	graceCtx, cancel := context.WithTimeout(ctx, m.forceDeleteAfter)
+	err := m.waitUntilWorkloadDeleted(graceCtx)
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	if err := m.forceDeletePods(ctx); err != nil {
+		return err
+	}
+
+	return m.waitUntilWorkloadDeleted(ctx)
+}
+
+// forceDeletePods deletes the app pods without a grace period
+func (m *AppManager) forceDeletePods(ctx context.Context) error {
+	podClient := m.client.Pods(m.namespace)
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return err
+	}
+
+	gracePeriod := int64(0)
+	for _, pod := range podList.Items {
+		log.Printf("Force deleting pod %s of %s which is still terminating after %s", pod.Name, m.app.AppName, m.forceDeleteAfter)
+		err := podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WaitUntilJobComplete waits until the app's Job succeeded and returns an error with the failure reason if it failed
+func (m *AppManager) WaitUntilJobComplete() error {
+	job, err := m.waitUntilJobState(context.TODO(), func(job *batchv1.Job, err error) bool {
+		return err == nil && (isJobConditionTrue(job, batchv1.JobComplete) || isJobConditionTrue(job, batchv1.JobFailed))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == apiv1.ConditionTrue {
+			return fmt.Errorf("job %q failed: %s: %s", m.app.AppName, condition.Reason, condition.Message)
+		}
+	}
+
+	return nil
+}
+
+// isJobConditionTrue returns true if job has the condition of conditionType with status True
+func isJobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == apiv1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// waitUntilJobState waits until isState returns true, the poll timeout elapses or ctx is done
+func (m *AppManager) waitUntilJobState(ctx context.Context, isState func(*batchv1.Job, error) bool) (*batchv1.Job, error) {
+	jobsClient := m.client.Jobs(m.namespace)
+
+	var lastJob *batchv1.Job
+
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastJob, err = jobsClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		done := isState(lastJob, err)
+		if !done && err != nil {
+			return true, err
+		}
+		return done, nil
+	})
+
+	if waitErr != nil {
+		return nil, fmt.Errorf("job %q is not in desired state, received: %+v: %s%s%s", m.app.AppName, lastJob, waitErr, m.initContainerFailures(), m.podWarningEvents())
+	}
+
+	return lastJob, nil
+}
+
+// GetJobLogs saves the container logs of the pods of the app's Job
+func (m *AppManager) GetJobLogs() error {
+	ctx := context.TODO()
+
+	// The job controller labels its pods with the job name
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", m.app.AppName),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.saveLogsOfPods(ctx, podList.Items, true)
+	return err
+}
+
+// WaitUntilDeploymentState waits until isState returns true
+//
+// Deprecated: use WaitUntilDeploymentStateWithContext to propagate test deadlines and cancellation.
+func (m *AppManager) WaitUntilDeploymentState(isState func(*appsv1.Deployment, error) bool) (*appsv1.Deployment, error) {
+	return m.WaitUntilDeploymentStateWithContext(context.Background(), isState)
+}
+
+// WaitUntilDeploymentStateWithContext waits until isState returns true, the poll timeout elapses or ctx is done
+func (m *AppManager) WaitUntilDeploymentStateWithContext(ctx context.Context, isState func(*appsv1.Deployment, error) bool) (*appsv1.Deployment, error) {
+	deploymentsClient := m.client.Deployments(m.namespace)
+
+	var lastDeployment *appsv1.Deployment
+
+	start := time.Now()
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastDeployment, err = deploymentsClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		done := isState(lastDeployment, err)
+		if !done && err != nil {
+			return true, err
+		}
+		return done, nil
+	})
+
+	if waitErr == wait.ErrWaitTimeout {
+		return nil, &DeploymentTimeoutError{
+			AppName:        m.app.AppName,
+			LastDeployment: lastDeployment,
+			Elapsed:        time.Since(start),
+			Diagnostics:    falseDeploymentConditions(lastDeployment) + replicaFailure(lastDeployment) + m.initContainerFailures() + m.podWarningEvents(),
+		}
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("deployment %q is not in desired state, received: %+v: %s%s%s%s%s", m.app.AppName, lastDeployment, waitErr, falseDeploymentConditions(lastDeployment), replicaFailure(lastDeployment), m.initContainerFailures(), m.podWarningEvents())
+	}
+
+	return lastDeployment, nil
+}
+
+// WaitUntilRolloutComplete waits until every replica of the app deployment runs the latest pod template, which is
+// stricter than IsDeploymentDone: the deployment must be updated and available, and no pods of older ReplicaSets,
+// including terminating ones, may remain. The timeout error names the ReplicaSet which is stuck.
+func (m *AppManager) WaitUntilRolloutComplete() error {
+	return m.WaitUntilRolloutCompleteWithContext(context.Background())
+}
+
+// WaitUntilRolloutCompleteWithContext is WaitUntilRolloutComplete with a context to propagate test deadlines
+// and cancellation
+func (m *AppManager) WaitUntilRolloutCompleteWithContext(ctx context.Context) error {
+	var pending string
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		pending, err = m.rolloutPending(ctx)
+		if err != nil {
+			return false, err
+		}
+		return pending == "", nil
+	})
+	if waitErr == wait.ErrWaitTimeout {
+		return fmt.Errorf("rollout of %s is not complete: %s: %w", m.app.AppName, pending, waitErr)
+	}
+
+	return waitErr
+}
+
+// rolloutPending describes why the rollout of the app deployment isn't complete, or returns an empty string
+// if it is
+func (m *AppManager) rolloutPending(ctx context.Context) (string, error) {
+	deployment, err := m.client.Deployments(m.namespace).Get(ctx, m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if status.ObservedGeneration < deployment.Generation {
+		return fmt.Sprintf("deployment generation %d is not observed yet", deployment.Generation), nil
+	}
+	if status.UpdatedReplicas != desired || status.Replicas != desired || status.AvailableReplicas != desired {
+		return fmt.Sprintf("deployment has %d updated, %d total and %d available of %d replicas",
+			status.UpdatedReplicas, status.Replicas, status.AvailableReplicas, desired), nil
+	}
+
+	replicaSetList, err := m.client.ReplicaSets(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The new ReplicaSet has the revision of the deployment
+	revision := deployment.Annotations[deploymentRevisionAnnotation]
+	currentHash := ""
+	for _, replicaSet := range replicaSetList.Items {
+		if replicaSet.Annotations[deploymentRevisionAnnotation] == revision {
+			currentHash = replicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+			break
+		}
+	}
+	if currentHash == "" {
+		return fmt.Sprintf("no ReplicaSet found for revision %s", revision), nil
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range podList.Items {
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash != currentHash {
+			return fmt.Sprintf("pod %s of ReplicaSet %s-%s still exists", pod.Name, m.app.AppName, hash), nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetDeploymentConditions returns the current conditions of the app deployment, e.g. Progressing and Available
+func (m *AppManager) GetDeploymentConditions() ([]appsv1.DeploymentCondition, error) {
+	deployment, err := m.client.Deployments(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return deployment.Status.Conditions, nil
+}
+
+// falseDeploymentConditions returns the conditions of deployment whose status is False formatted for an error message
+func falseDeploymentConditions(deployment *appsv1.Deployment) string {
+	if deployment == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Status == apiv1.ConditionFalse {
+			fmt.Fprintf(&sb, "\n  %s: %s: %s", condition.Type, condition.Reason, condition.Message)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+
+	return "\nfailing conditions:" + sb.String()
+}
+
+// replicaFailure returns the ReplicaFailure condition of deployment formatted for an error message, calling out
+// pods which were rejected by a ResourceQuota
+func replicaFailure(deployment *appsv1.Deployment) string {
+	if deployment == nil {
+		return ""
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type != appsv1.DeploymentReplicaFailure || condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+		if strings.Contains(condition.Message, "exceeded quota") {
+			return "\npods are rejected by a ResourceQuota: " + condition.Message
+		}
+		return fmt.Sprintf("\nreplica failure: %s: %s", condition.Reason, condition.Message)
+	}
+
+	return ""
+}
+
+// podWarningEvents returns the most recent Warning events of the app pods formatted for an error message.
+// Failures to collect the events are logged and an empty string is returned.
+func (m *AppManager) podWarningEvents() string {
+	// The caller's context may already be expired, so use a fresh one bounded by diagnosticsTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		log.Printf("Failed to list pods for %s to collect events. Error was: %s", m.app.AppName, err)
+		return ""
+	}
+
+	podNames := map[string]bool{}
+	for _, pod := range podList.Items {
+		podNames[pod.GetName()] = true
+	}
+
+	eventList, err := m.client.Events(m.namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + apiv1.EventTypeWarning,
+	})
+	if err != nil {
+		log.Printf("Failed to list events for %s. Error was: %s", m.app.AppName, err)
+		return ""
+	}
+
+	events := []apiv1.Event{}
+	for _, event := range eventList.Items {
+		if event.Type == apiv1.EventTypeWarning && event.InvolvedObject.Kind == "Pod" && podNames[event.InvolvedObject.Name] {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		return ""
+	}
+
+	// Most recent events first
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[j].LastTimestamp.Before(&events[i].LastTimestamp)
+	})
+	if len(events) > maxWarningEvents {
+		events = events[:maxWarningEvents]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\nrecent warning events:")
+	for _, event := range events {
+		fmt.Fprintf(&sb, "\n  pod %s: %s: %s", event.InvolvedObject.Name, event.Reason, event.Message)
+	}
+
+	return sb.String()
+}
+
+// GetEvents returns the events involving the app pods and workload, oldest first
+func (m *AppManager) GetEvents() ([]apiv1.Event, error) {
+	return m.getEvents(context.TODO())
+}
+
+func (m *AppManager) getEvents(ctx context.Context) ([]apiv1.Event, error) {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	podNames := map[string]bool{}
+	for _, pod := range podList.Items {
+		podNames[pod.GetName()] = true
+	}
+
+	eventList, err := m.client.Events(m.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	workloadKind := m.workloadKind()
+	events := []apiv1.Event{}
+	for _, event := range eventList.Items {
+		involved := event.InvolvedObject
+		if (involved.Kind == "Pod" && podNames[involved.Name]) || (involved.Kind == workloadKind && involved.Name == m.app.AppName) {
+			events = append(events, event)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+
+	return events, nil
+}
+
+// workloadKind returns the Kubernetes kind of the app workload
+func (m *AppManager) workloadKind() string {
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		return "StatefulSet"
+	case WorkloadTypeJob:
+		return "Job"
+	default:
+		return "Deployment"
+	}
+}
+
+// WaitForEvent waits until an event with the given reason involves the app pods or workload,
+// the poll timeout elapses or ctx is done
+func (m *AppManager) WaitForEvent(ctx context.Context, reason string) (*apiv1.Event, error) {
+	var found *apiv1.Event
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		events, err := m.getEvents(ctx)
+		if err != nil {
+			return false, err
+		}
+		for i := range events {
+			if events[i].Reason == reason {
+				found = &events[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+
+	if waitErr != nil {
+		return nil, fmt.Errorf("no event with reason %q for %q: %s", reason, m.app.AppName, waitErr)
+	}
+
+	return found, nil
+}
+
+// WaitUntilStatefulSetStateWithContext waits until isState returns true, the poll timeout elapses or ctx is done
+func (m *AppManager) WaitUntilStatefulSetStateWithContext(ctx context.Context, isState func(*appsv1.StatefulSet, error) bool) (*appsv1.StatefulSet, error) {
+	statefulSetsClient := m.client.StatefulSets(m.namespace)
+
+	var lastStatefulSet *appsv1.StatefulSet
+
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastStatefulSet, err = statefulSetsClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		done := isState(lastStatefulSet, err)
+		if !done && err != nil {
+			return true, err
+		}
+		return done, nil
+	})
+
+	if waitErr != nil {
+		return nil, fmt.Errorf("statefulset %q is not in desired state, received: %+v: %s%s%s", m.app.AppName, lastStatefulSet, waitErr, m.initContainerFailures(), m.podWarningEvents())
+	}
+
+	return lastStatefulSet, nil
+}
+
+// initContainerFailures returns the init containers of the app pods which failed or are stuck, formatted for
+// an error message. Failures to collect the pods are logged and an empty string is returned.
+func (m *AppManager) initContainerFailures() string {
+	if len(m.app.InitContainers) == 0 {
+		return ""
+	}
+
+	// The caller's context may already be expired, so use a fresh one bounded by diagnosticsTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		log.Printf("Failed to list pods for %s to collect init container states. Error was: %s", m.app.AppName, err)
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, pod := range podList.Items {
+		for _, status := range pod.Status.InitContainerStatuses {
+			var state string
+			switch {
+			case status.State.Terminated != nil && status.State.Terminated.ExitCode != 0:
+				state = fmt.Sprintf("terminated: %s (exit code %d)", status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+			case status.State.Waiting != nil && status.State.Waiting.Reason != "PodInitializing":
+				state = fmt.Sprintf("waiting: %s", strings.TrimSpace(status.State.Waiting.Reason+" "+status.State.Waiting.Message))
+			case status.State.Running != nil:
+				state = "still running"
+			default:
+				continue
+			}
+			fmt.Fprintf(&sb, "\n  pod %s: init container %s %s, restarts: %d", pod.Name, status.Name, state, status.RestartCount)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+
+	return "\ninit container failures:" + sb.String()
+}
+
+// IsStatefulSetDone returns true if all replicas of the StatefulSet are ready and run the latest revision
+func (m *AppManager) IsStatefulSetDone(statefulSet *appsv1.StatefulSet, err error) bool {
+	return err == nil && statefulSet.Generation == statefulSet.Status.ObservedGeneration && statefulSet.Status.ReadyReplicas == m.replicas() && statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision
+}
+
+// IsStatefulSetDeleted returns true if StatefulSet does not exist
+func (m *AppManager) IsStatefulSetDeleted(statefulSet *appsv1.StatefulSet, err error) bool {
+	return err != nil && errors.IsNotFound(err)
+}
+
+// IsDeploymentDone returns true if deployment object completes pod deployments
+func (m *AppManager) IsDeploymentDone(deployment *appsv1.Deployment, err error) bool {
+	return err == nil && deployment.Generation == deployment.Status.ObservedGeneration && deployment.Status.ReadyReplicas == m.replicas() && deployment.Status.AvailableReplicas == m.replicas()
+}
+
+// IsDeploymentDeleted returns true if deployment does not exist or current pod replica is zero
+func (m *AppManager) IsDeploymentDeleted(deployment *appsv1.Deployment, err error) bool {
+	return err != nil && errors.IsNotFound(err)
+}
+
+// ValidiateSideCar validates that dapr side car is running in dapr enabled pods
+func (m *AppManager) ValidiateSideCar() (bool, error) {
+	return m.validateSideCar(context.TODO())
+}
+
+func (m *AppManager) validateSideCar(ctx context.Context) (bool, error) {
+	if !m.app.DaprEnabled {
+		return false, fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	podClient := m.client.Pods(m.namespace)
+
+	// Filter only 'testapp=appName' labeled Pods
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	replicas := m.replicas()
+	if len(podList.Items) != int(replicas) {
+		return false, fmt.Errorf("expected number of pods for %s: %d, received: %d", m.app.AppName, replicas, len(podList.Items))
+	}
+
+	// Each pod must have daprd sidecar
+	for _, pod := range podList.Items {
+		daprdFound := false
+		for _, container := range pod.Spec.Containers {
+			if container.Name == DaprSideCarName {
+				daprdFound = true
+			}
+		}
+		if !daprdFound {
+			return false, fmt.Errorf("cannot find dapr sidecar in pod %s", pod.Name)
+		}
+	}
+
+	return true, nil
+}
+
+// ValidateSidecarReady validates that dapr side car is running and ready in every dapr enabled pod
+func (m *AppManager) ValidateSidecarReady() (bool, error) {
+	if !m.app.DaprEnabled {
+		return false, fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	notReady, err := m.sidecarsNotReady(context.TODO())
+	if err != nil {
+		return false, err
+	}
+
+	if len(notReady) > 0 {
+		return false, fmt.Errorf("dapr sidecar is not ready in pods: %s", strings.Join(notReady, ", "))
+	}
+
+	return true, nil
+}
+
+// WaitUntilSidecarReady waits until the dapr side car is ready in every app pod, i.e. it is connected
+// to the control plane. The timeout error lists the pods whose side car isn't ready.
+func (m *AppManager) WaitUntilSidecarReady(ctx context.Context) error {
+	if !m.app.DaprEnabled {
+		return fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	var notReady []string
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		notReady, err = m.sidecarsNotReady(ctx)
+		if err != nil {
+			return false, err
+		}
+		return len(notReady) == 0, nil
+	})
+	if waitErr == wait.ErrWaitTimeout {
+		return fmt.Errorf("dapr sidecar is not ready in pods of %s: %s: %w", m.app.AppName, strings.Join(notReady, ", "), waitErr)
+	}
+
+	return waitErr
+}
+
+// sidecarsNotReady lists the app pods whose side car isn't running and ready, with the reason
+func (m *AppManager) sidecarsNotReady(ctx context.Context) ([]string, error) {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(podList.Items) == 0 {
+		return nil, fmt.Errorf("no pods found for %s", m.app.AppName)
+	}
+
+	notReady := []string{}
+	for _, pod := range podList.Items {
+		var sidecarStatus *apiv1.ContainerStatus
+		for i, status := range pod.Status.ContainerStatuses {
+			if status.Name == DaprSideCarName {
+				sidecarStatus = &pod.Status.ContainerStatuses[i]
+				break
+			}
+		}
+
+		switch {
+		case sidecarStatus == nil:
+			notReady = append(notReady, fmt.Sprintf("%s (no sidecar status)", pod.Name))
+		case sidecarStatus.State.Running == nil:
+			notReady = append(notReady, fmt.Sprintf("%s (sidecar not running)", pod.Name))
+		case !sidecarStatus.Ready:
+			notReady = append(notReady, fmt.Sprintf("%s (sidecar not ready)", pod.Name))
+		}
+	}
+
+	return notReady, nil
+}
+
+// DoPortForwarding performs port forwarding for given podname to access test apps in the cluster.
+// The returned local ports are bound by the forward, local ports taken by other processes are remapped.
+func (m *AppManager) DoPortForwarding(podName string, targetPorts ...int) ([]int, error) {
+	podClient := m.client.Pods(m.namespace)
+	// Filter only 'testapp=appName' labeled Pods
+	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := podName
+
+	// if given pod name is empty , pick the first matching pod name
+	if name == "" {
+		for _, pod := range podList.Items {
+			name = pod.Name
+			break
+		}
+	}
+
+	return m.portForwarder().Connect(name, targetPorts...)
+}
+
+// ExecInPod runs cmd in a container of the given pod and returns its stdout and stderr. The first app pod
+// is used if podName is empty and the app container if containerName is empty.
+func (m *AppManager) ExecInPod(podName, containerName string, cmd []string) (string, string, error) {
+	podName, containerName, err := m.execTarget(context.TODO(), podName, containerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = m.execStream(podName, containerName, cmd, nil, &stdout, &stderr)
+
+	return stdout.String(), stderr.String(), err
+}
+
+// execStream runs cmd in a container of the given pod, streaming stdin to it if not nil
+func (m *AppManager) execStream(podName, containerName string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	config := m.client.GetClientConfig()
+	if config == nil {
+		return fmt.Errorf("no client config to exec in pod %s", podName)
+	}
+
+	req := m.client.ClientSet.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(m.namespace).
+		SubResource("exec").
+		VersionedParams(&apiv1.PodExecOptions{
+			Container: containerName,
+			Command:   cmd,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return err
+	}
+
+	err = exec.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("exec %v in %s/%s failed: %w", cmd, podName, containerName, err)
+	}
+
+	return nil
+}
+
+// CopyFromPod copies the file or directory srcPath out of a container to dstLocal like kubectl cp, which
+// requires tar in the container. The first app pod is used if podName is empty and the app container if
+// containerName is empty.
+func (m *AppManager) CopyFromPod(podName, containerName, srcPath, dstLocal string) error {
+	podName, containerName, err := m.execTarget(context.TODO(), podName, containerName)
+	if err != nil {
+		return err
+	}
+
+	srcPath = path.Clean(srcPath)
+	reader, writer := io.Pipe()
+	var stderr bytes.Buffer
+	go func() {
+		cmd := []string{"tar", "cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+		writer.CloseWithError(m.execStream(podName, containerName, cmd, nil, writer, &stderr))
+	}()
+
+	if err := extractTar(reader, path.Base(srcPath), dstLocal); err != nil {
+		return fmt.Errorf("copy %s from %s/%s failed: %s: %w", srcPath, podName, containerName, stderr.String(), err)
+	}
+
+	return nil
+}
+
+// CopyToPod copies the local file or directory srcLocal into a container as dstPath like kubectl cp, which
+// requires tar in the container. The first app pod is used if podName is empty and the app container if
+// containerName is empty.
+func (m *AppManager) CopyToPod(podName, containerName, srcLocal, dstPath string) error {
+	podName, containerName, err := m.execTarget(context.TODO(), podName, containerName)
+	if err != nil {
+		return err
+	}
+
+	dstPath = path.Clean(dstPath)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTar(writer, srcLocal, path.Base(dstPath)))
+	}()
+
+	var stdout, stderr bytes.Buffer
+	cmd := []string{"tar", "xf", "-", "-C", path.Dir(dstPath)}
+	if err := m.execStream(podName, containerName, cmd, reader, &stdout, &stderr); err != nil {
+		return fmt.Errorf("copy %s to %s/%s failed: %s: %w", srcLocal, podName, containerName, stderr.String(), err)
+	}
+
+	return nil
+}
+
+// writeTar writes the local file or directory srcLocal as a tar archive whose entries are rooted at name
+func writeTar(w io.Writer, srcLocal, name string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(srcLocal, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcLocal, file)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// extractTar extracts the entries of a tar archive rooted at name to dstLocal, dropping entries outside of it
+func extractTar(r io.Reader, name, dstLocal string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := path.Clean(header.Name)
+		if entry != name && !strings.HasPrefix(entry, name+"/") {
+			continue
+		}
+		target := filepath.Join(dstLocal, filepath.FromSlash(strings.TrimPrefix(entry, name)))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// execTarget defaults podName to the first app pod and containerName to the app container
+func (m *AppManager) execTarget(ctx context.Context, podName, containerName string) (string, string, error) {
+	if containerName == "" {
+		containerName = m.app.AppName
+	}
+
+	if podName != "" {
+		return podName, containerName, nil
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if len(podList.Items) == 0 {
+		return "", "", fmt.Errorf("no pods found for %s", m.app.AppName)
+	}
+
+	return podList.Items[0].Name, containerName, nil
+}
+
+// PortForwardUDP forwards a local UDP port to udpPort of the given pod, or the first app pod if podName is empty.
+// udpPort must be listed in UDPPorts, the datagrams are tunneled through a port forward to the socat relay
+// container which is added to the pod for them. See ConnectUDP for the one datagram in flight limitation.
+func (m *AppManager) PortForwardUDP(podName string, udpPort int) (int, error) {
+	relayIndex := -1
+	for i, port := range m.app.UDPPorts {
+		if port == udpPort {
+			relayIndex = i
+			break
+		}
+	}
+	if relayIndex < 0 {
+		return 0, fmt.Errorf("udp port %d is not in UDPPorts of %s", udpPort, m.app.AppName)
+	}
+
+	forwarder := m.portForwarder()
+	if forwarder == nil {
+		return 0, fmt.Errorf("port forwarding is not initialized for %s", m.app.AppName)
+	}
+
+	name := podName
+	if name == "" {
+		podList, err := m.client.Pods(m.namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: m.appLabelSelector(),
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(podList.Items) == 0 {
+			return 0, fmt.Errorf("no pods found for %s", m.app.AppName)
+		}
+		name = podList.Items[0].Name
+	}
+
+	return forwarder.ConnectUDP(name, udpRelayPort(relayIndex))
+}
+
+// PortForwardToService performs port forwarding to the app service, which picks a ready pod behind it
+func (m *AppManager) PortForwardToService(targetPorts ...int) ([]int, error) {
+	forwarder := m.portForwarder()
+	if forwarder == nil {
+		return nil, fmt.Errorf("port forwarding is not initialized for %s", m.app.AppName)
+	}
+
+	return forwarder.ConnectToService(m.app.AppName, targetPorts...)
+}
+
+// StopPortForwarding closes the port forwards to the given pod and releases their local ports
+func (m *AppManager) StopPortForwarding(podName string) error {
+	forwarder := m.portForwarder()
+	if forwarder == nil {
+		return fmt.Errorf("no active port forwarding for %s", m.app.AppName)
+	}
+
+	return forwarder.Stop(podName)
+}
+
+// HealthCheck forwards a local port to the app port of the first app pod and polls path
+// until it responds with expectStatus, the poll timeout elapses or ctx is done.
+func (m *AppManager) HealthCheck(ctx context.Context, path string, expectStatus int) error {
+	appPort := DefaultContainerPort
+	if m.app.AppPort > 0 {
+		appPort = m.app.AppPort
+	}
+
+	ports, err := m.DoPortForwarding("", appPort)
+	if err != nil {
+		return err
+	}
+
+	return m.waitForHTTPStatus(ctx, fmt.Sprintf("http://localhost:%d%s", ports[0], path), expectStatus, false)
+}
+
+// WaitForSidecarMetrics forwards a local port to the side car metrics port of the first app pod and polls
+// /metrics until it serves a non empty response, the poll timeout elapses or ctx is done.
+func (m *AppManager) WaitForSidecarMetrics(ctx context.Context) error {
+	metricsPort, err := m.sidecarMetricsPort()
+	if err != nil {
+		return err
+	}
+
+	ports, err := m.DoPortForwarding("", metricsPort)
+	if err != nil {
+		return err
+	}
+
+	return m.waitForHTTPStatus(ctx, fmt.Sprintf("http://localhost:%d/metrics", ports[0]), http.StatusOK, true)
+}
+
+// GetSidecarMetrics scrapes the side car metrics endpoint of the first app pod and returns the parsed metric families
+// by name. The forwarded port is kept until Dispose.
+func (m *AppManager) GetSidecarMetrics() (map[string]*dto.MetricFamily, error) {
+	m.lock.RLock()
+	localPort := m.metricsLocalPort
+	m.lock.RUnlock()
+
+	if localPort == 0 {
+		metricsPort, err := m.sidecarMetricsPort()
+		if err != nil {
+			return nil, err
+		}
+
+		ports, err := m.DoPortForwarding("", metricsPort)
+		if err != nil {
+			return nil, err
+		}
+		localPort = ports[0]
+
+		m.lock.Lock()
+		m.metricsLocalPort = localPort
+		m.lock.Unlock()
+	}
+
+	families, err := fetchMetrics(fmt.Sprintf("http://localhost:%d/metrics", localPort))
+	if err != nil {
+		// Forward again on the next call in case the pod went away
+		m.lock.Lock()
+		m.metricsLocalPort = 0
+		m.lock.Unlock()
+		return nil, err
+	}
+
+	return families, nil
+}
+
+// InvokeMethod invokes method of the app through the dapr side car HTTP API of the first app pod, i.e.
+// /v1.0/invoke/<app-id>/method/<method>, and returns the response body and status. Refused connections and
+// 5xx responses are retried, the body and status of the last attempt are returned. The forwarded port is
+// kept until Dispose.
+func (m *AppManager) InvokeMethod(ctx context.Context, method, verb string, body []byte) ([]byte, int, error) {
+	appID, err := m.GetDaprAppID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	localPort, err := m.sidecarHTTPLocalPort()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	retries := m.invokeRetries
+	if retries <= 0 {
+		retries = defaultInvokeRetries
+	}
+
+	url := fmt.Sprintf("http://localhost:%d/v1.0/invoke/%s/method/%s", localPort, appID, strings.TrimPrefix(method, "/"))
+	respBody, status, err := invokeWithRetry(ctx, url, verb, body, retries, defaultInvokeRetryDelay)
+	if err != nil {
+		// Forward again on the next call in case the pod went away
+		m.lock.Lock()
+		m.invokeLocalPort = 0
+		m.lock.Unlock()
+	}
+
+	return respBody, status, err
+}
+
+// DialSidecarGRPC forwards a local port to the side car gRPC port of the first app pod and returns a connection
+// to it which is Ready, along with a cleanup func closing the connection. The forwarded port is kept until Dispose.
+// Dialing gives up after the poll timeout unless ctx expires first.
+func (m *AppManager) DialSidecarGRPC(ctx context.Context) (*grpc.ClientConn, func(), error) {
+	grpcPort, err := m.GetSidecarGRPCPort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ports, err := m.DoPortForwarding("", grpcPort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, timeout := m.pollConfig()
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dialGRPC(dialCtx, fmt.Sprintf("localhost:%d", ports[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to side car gRPC port of %s: %s", m.app.AppName, err)
+	}
+
+	return conn, func() { conn.Close() }, nil
+}
+
+// dialGRPC connects to address without TLS, blocking until the connection is Ready or ctx expires
+func dialGRPC(ctx context.Context, address string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+}
+
+// sidecarHTTPLocalPort returns the local port forwarded to the side car HTTP port of the first app pod,
+// forwarding one if there is none yet
+func (m *AppManager) sidecarHTTPLocalPort() (int, error) {
+	m.lock.RLock()
+	localPort := m.invokeLocalPort
+	m.lock.RUnlock()
+
+	if localPort != 0 {
+		return localPort, nil
+	}
+
+	httpPort, err := m.GetSidecarHTTPPort()
+	if err != nil {
+		return 0, err
+	}
+
+	ports, err := m.DoPortForwarding("", httpPort)
+	if err != nil {
+		return 0, err
+	}
+
+	m.lock.Lock()
+	m.invokeLocalPort = ports[0]
+	m.lock.Unlock()
+
+	return ports[0], nil
+}
+
+// ErrSidecarMetadataUnavailable is returned when the side car doesn't serve the metadata API, e.g. older versions
+var ErrSidecarMetadataUnavailable = fmt.Errorf("dapr side car metadata API is unavailable")
+
+// sidecarMetadata is the response of the side car metadata API
+type sidecarMetadata struct {
+	ID             string            `json:"id"`
+	RuntimeVersion string            `json:"runtimeVersion"`
+	Extended       map[string]string `json:"extended"`
+	Components     []ComponentInfo   `json:"components"`
+}
+
+// ComponentInfo describes a component loaded by the dapr side car
+type ComponentInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// GetSidecarVersion returns the version of the running dapr side car of the first app pod, read from its
+// metadata API. ErrSidecarMetadataUnavailable is returned if the side car doesn't serve the metadata API
+// or doesn't report its version.
+func (m *AppManager) GetSidecarVersion() (string, error) {
+	metadata, err := m.getSidecarMetadata(context.TODO())
+	if err != nil {
+		return "", err
+	}
+
+	if metadata.RuntimeVersion != "" {
+		return metadata.RuntimeVersion, nil
+	}
+	// Versions before runtimeVersion was added report it as extended metadata
+	if version := metadata.Extended["daprRuntimeVersion"]; version != "" {
+		return version, nil
+	}
+
+	return "", ErrSidecarMetadataUnavailable
+}
+
+// GetLoadedComponents returns the components loaded by the dapr side car of the first app pod,
+// read from its metadata API
+func (m *AppManager) GetLoadedComponents() ([]ComponentInfo, error) {
+	metadata, err := m.getSidecarMetadata(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.Components, nil
+}
+
+// getSidecarMetadata calls the metadata API of the side car of the first app pod
+func (m *AppManager) getSidecarMetadata(ctx context.Context) (*sidecarMetadata, error) {
+	localPort, err := m.sidecarHTTPLocalPort()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := fetchSidecarMetadata(ctx, fmt.Sprintf("http://localhost:%d/v1.0/metadata", localPort))
+	if err != nil && err != ErrSidecarMetadataUnavailable {
+		// Forward again on the next call in case the pod went away
+		m.lock.Lock()
+		m.invokeLocalPort = 0
+		m.lock.Unlock()
+	}
+
+	return metadata, err
+}
+
+// fetchSidecarMetadata gets url and parses the side car metadata
+func fetchSidecarMetadata(ctx context.Context, url string) (*sidecarMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: healthCheckRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrSidecarMetadataUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %s", url, resp.Status)
+	}
+
+	var metadata sidecarMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse side car metadata from %s: %s", url, err)
+	}
+
+	return &metadata, nil
+}
+
+// invokeWithRetry sends body to url with the given verb, retrying refused connections and 5xx responses
+// with an exponential backoff starting at delay
+func invokeWithRetry(ctx context.Context, url, verb string, body []byte, retries int, delay time.Duration) ([]byte, int, error) {
+	client := &http.Client{Timeout: invokeRequestTimeout}
+
+	var (
+		respBody []byte
+		status   int
+		lastErr  error
+	)
+	backoff := wait.Backoff{
+		Duration: delay,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    retries + 1,
+	}
+	waitErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, verb, url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if utilnet.IsConnectionRefused(err) {
+				lastErr = err
+				return false, nil
+			}
+			return false, err
+		}
+		defer resp.Body.Close()
+
+		respBody, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		status = resp.StatusCode
+		lastErr = nil
+
+		return status < http.StatusInternalServerError, nil
+	})
+
+	if waitErr == wait.ErrWaitTimeout {
+		if lastErr != nil {
+			return nil, 0, fmt.Errorf("failed to invoke %s after %d retries: %w", url, retries, lastErr)
+		}
+		return respBody, status, nil
+	}
+	if waitErr != nil {
+		return nil, 0, waitErr
+	}
+
+	return respBody, status, nil
+}
+
+// fetchMetrics gets url and parses the response in the Prometheus text format
+func fetchMetrics(url string) (map[string]*dto.MetricFamily, error) {
+	client := &http.Client{Timeout: healthCheckRequestTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %s", url, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// sidecarMetricsPort returns the side car metrics port of the app
+func (m *AppManager) sidecarMetricsPort() (int, error) {
+	if !m.app.DaprEnabled || !m.app.MetricsEnabled {
+		return 0, fmt.Errorf("dapr side car metrics are not enabled for %s", m.app.AppName)
+	}
+
+	if m.app.MetricsPort == "" {
+		return DefaultSidecarMetricsPort, nil
+	}
+
+	port, err := strconv.Atoi(m.app.MetricsPort)
+	if err != nil {
+		return 0, fmt.Errorf("invalid metrics port %q for %s: %s", m.app.MetricsPort, m.app.AppName, err)
+	}
+
+	return port, nil
+}
+
+// waitForHTTPStatus polls url until it responds with expectStatus and, if requireBody is true, a non empty body,
+// the poll timeout elapses or ctx is done
+func (m *AppManager) waitForHTTPStatus(ctx context.Context, url string, expectStatus int, requireBody bool) error {
+	client := &http.Client{Timeout: healthCheckRequestTimeout}
+
+	lastStatus := ""
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			// The app may still be starting and refuse connections
+			lastStatus = err.Error()
+			return false, nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		lastStatus = resp.Status
+		if err != nil {
+			lastStatus = err.Error()
+			return false, nil
+		}
+		if requireBody && len(body) == 0 {
+			lastStatus += " with empty body"
+			return false, nil
+		}
+		return resp.StatusCode == expectStatus, nil
+	})
+
+	if waitErr != nil {
+		return fmt.Errorf("%s did not respond with status %d, last response: %s: %s", url, expectStatus, lastStatus, waitErr)
+	}
+
+	return nil
+}
+
+// ScaleDeploymentReplica scales the deployment and waits until the new number of replicas is ready
+func (m *AppManager) ScaleDeploymentReplica(replicas int32) error {
+	if err := m.ScaleDeploymentReplicaNoWait(replicas); err != nil {
+		return err
+	}
+
+	// m.app.Replicas holds the new target which the readiness check compares against
+	return m.WaitUntilWorkloadReady(context.TODO())
+}
+
+// ScaleDown scales the app down to replicas and waits until the pods expected to be removed are gone,
+// the poll timeout elapses or ctx is done. The names of these pods are returned so graceful shutdown
+// can be asserted on them. StatefulSets remove the pods with the highest ordinal, Deployments are
+// assumed to remove the newest pods first.
+func (m *AppManager) ScaleDown(ctx context.Context, replicas int32) ([]string, error) {
+	current := m.replicas()
+	if replicas >= current {
+		return nil, fmt.Errorf("%d is not less than the current %d replicas of %s", replicas, current, m.app.AppName)
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := scaleDownCandidates(podList.Items, len(podList.Items)-int(replicas), m.isStatefulSet())
+
+	if err := m.ScaleDeploymentReplicaNoWait(replicas); err != nil {
+		return nil, err
+	}
+
+	podClient := m.client.Pods(m.namespace)
+	remaining := []string{}
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		remaining = remaining[:0]
+		for _, name := range removed {
+			pod, err := podClient.Get(ctx, name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if pod.DeletionTimestamp != nil {
+				log.Printf("Pod %s of %s is terminating", name, m.app.AppName)
+			}
+			remaining = append(remaining, name)
+		}
+		return len(remaining) == 0, nil
+	})
+
+	if waitErr != nil {
+		return removed, fmt.Errorf("pods of %s were not removed: %v: %s", m.app.AppName, remaining, waitErr)
+	}
+
+	return removed, nil
+}
+
+// scaleDownCandidates returns the names of the count pods expected to be removed by a scale down
+func scaleDownCandidates(pods []apiv1.Pod, count int, statefulSet bool) []string {
+	if count <= 0 {
+		return []string{}
+	}
+
+	sorted := make([]apiv1.Pod, len(pods))
+	copy(sorted, pods)
+	if statefulSet {
+		// Pod names end with their ordinal
+		ordinal := func(pod apiv1.Pod) int {
+			n, _ := strconv.Atoi(pod.Name[strings.LastIndex(pod.Name, "-")+1:])
+			return n
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return ordinal(sorted[i]) > ordinal(sorted[j])
+		})
+	} else {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+		})
+	}
+
+	if count > len(sorted) {
+		count = len(sorted)
+	}
+
+	names := make([]string, 0, count)
+	for _, pod := range sorted[:count] {
+		names = append(names, pod.Name)
+	}
+
+	return names
+}
+
+// ScaleDeploymentReplicaNoWait scales the deployment without waiting for the new replicas
+func (m *AppManager) ScaleDeploymentReplicaNoWait(replicas int32) error {
+	if m.app.WorkloadType == WorkloadTypeJob {
+		return fmt.Errorf("job %q can't be scaled", m.app.AppName)
+	}
+
+	limit := m.app.MaxReplicas
+	if limit <= 0 {
+		limit = maxReplicas
+	}
+
+	if replicas < 0 || replicas > limit {
+		return fmt.Errorf("%d is out of range, replicas must be between 0 and %d", replicas, limit)
+	}
+
+	if m.isStatefulSet() {
+		statefulSetsClient := m.client.StatefulSets(m.namespace)
+
+		scale, err := statefulSetsClient.GetScale(context.TODO(), m.app.AppName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if scale.Spec.Replicas == replicas {
+			return nil
+		}
+
+		scale.Spec.Replicas = replicas
+		m.setReplicas(replicas)
+
+		_, err = statefulSetsClient.UpdateScale(context.TODO(), m.app.AppName, scale, metav1.UpdateOptions{})
+
+		return err
+	}
+
+	deploymentsClient := m.client.Deployments(m.namespace)
+
+	scale, err := deploymentsClient.GetScale(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if scale.Spec.Replicas == replicas {
+		return nil
+	}
+
+	scale.Spec.Replicas = replicas
+	m.setReplicas(replicas)
+
+	_, err = deploymentsClient.UpdateScale(context.TODO(), m.app.AppName, scale, metav1.UpdateOptions{})
+
+	return err
+}
+
+// RolloutRestart recreates the app pods like `kubectl rollout restart` by stamping the pod template
+// with the restart time, and waits until the new pods are ready and the old ones are gone.
+func (m *AppManager) RolloutRestart() error {
+	return m.rolloutPodTemplateAnnotation(context.TODO(), restartedAtAnnotation, time.Now().Format(time.RFC3339))
+}
+
+// ErrSidecarImageOverrideUnsupported is returned by SetSidecarImage since the sidecar injector has no per app
+// image override
+var ErrSidecarImageOverrideUnsupported = fmt.Errorf("dapr sidecar injector doesn't support overriding the side car image per app")
+
+// SetSidecarImage fails with ErrSidecarImageOverrideUnsupported once the side car is found in the app pods. The
+// injector always injects the image of its SIDECAR_IMAGE env var and skips pods whose template already has a
+// daprd container, so neither an annotation nor a patched pod template can change the image. Upgrade the
+// control plane to test version skew instead.
+func (m *AppManager) SetSidecarImage(image string) error {
+	// The side car is injected into the pods, so it's only found in the live pod spec
+	if _, err := m.sidecarImages(context.TODO()); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("can't run %s with side car image %s: %w", m.app.AppName, image, ErrSidecarImageOverrideUnsupported)
+}
+
+// GetSidecarHTTPPort returns the port of the dapr side car HTTP API, read from the injected side car
+// container of the first app pod. DefaultSidecarHTTPPort is returned if the port isn't declared.
+func (m *AppManager) GetSidecarHTTPPort() (int, error) {
+	return m.sidecarPort("dapr-http", DefaultSidecarHTTPPort)
+}
+
+// GetSidecarGRPCPort returns the port of the dapr side car gRPC API, read from the injected side car
+// container of the first app pod. DefaultSidecarGRPCPort is returned if the port isn't declared.
+func (m *AppManager) GetSidecarGRPCPort() (int, error) {
+	return m.sidecarPort("dapr-grpc", DefaultSidecarGRPCPort)
+}
+
+// sidecarPort returns the side car container port named portName or defaultPort if it isn't declared
+func (m *AppManager) sidecarPort(portName string, defaultPort int) (int, error) {
+	if !m.app.DaprEnabled {
+		return 0, fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(podList.Items) == 0 {
+		return 0, fmt.Errorf("no pods found for %s", m.app.AppName)
+	}
+
+	pod := podList.Items[0]
+	for _, container := range pod.Spec.Containers {
+		if container.Name != DaprSideCarName {
+			continue
+		}
+		for _, port := range container.Ports {
+			if port.Name == portName {
+				return int(port.ContainerPort), nil
+			}
+		}
+		return defaultPort, nil
+	}
+
+	return 0, fmt.Errorf("cannot find dapr sidecar in pod %s", pod.Name)
+}
+
+// GetSidecarImage returns the image of the dapr side car in a running app pod
+func (m *AppManager) GetSidecarImage() (string, error) {
+	if !m.app.DaprEnabled {
+		return "", fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	return m.runningContainerImage(DaprSideCarName)
+}
+
+// GetAppImage returns the image of the app container in a running app pod
+func (m *AppManager) GetAppImage() (string, error) {
+	return m.runningContainerImage(m.app.AppName)
+}
+
+// runningContainerImage returns the image of containerName read from the spec of the first running app pod,
+// so side car images injected or patched after the deployment was created are reflected
+func (m *AppManager) runningContainerImage(containerName string) (string, error) {
+	pod, err := m.firstRunningPod(context.TODO())
+	if err != nil {
+		return "", err
+	}
+
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return container.Image, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find container %s in pod %s", containerName, pod.Name)
+}
+
+// GetSidecarConfigName returns the name of the dapr Configuration loaded by the side car, read from the
+// dapr.io/config annotation of a running app pod. An empty string is returned if no config is set.
+func (m *AppManager) GetSidecarConfigName() (string, error) {
+	if !m.app.DaprEnabled {
+		return "", fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	pod, err := m.firstRunningPod(context.TODO())
+	if err != nil {
+		return "", err
+	}
+
+	return pod.Annotations["dapr.io/config"], nil
+}
+
+// IsMTLSEnabled returns whether mTLS between the dapr side cars is enabled. The source of truth is the spec.mtls.enabled
+// field of the daprsystem Configuration of the control plane in DaprTestNamespace, which the side car injector reads
+// when it injects the side car; the side car metadata API doesn't expose it. Like the injector, mTLS is considered
+// enabled if the Configuration doesn't exist. Pods injected before a change keep the previous setting until restarted.
+func (m *AppManager) IsMTLSEnabled() (bool, error) {
+	config, err := m.client.DaprConfigurations(DaprTestNamespace).Get(daprSystemConfigName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return config.Spec.MTLSSpec.Enabled, nil
+}
+
+// GetDaprAppID returns the Dapr app ID of the app, read from the dapr.io/app-id annotation of a running app pod.
+// The app name is returned if the annotation isn't set.
+func (m *AppManager) GetDaprAppID() (string, error) {
+	pod, err := m.firstRunningPod(context.TODO())
+	if err != nil {
+		return "", err
+	}
+
+	if appID := pod.Annotations["dapr.io/app-id"]; appID != "" {
+		return appID, nil
+	}
+
+	return m.app.AppName, nil
+}
+
+// validateAppID checks that the pod template of a dapr enabled app sets a Dapr app ID,
+// which PodAnnotations can override with an empty value
+func (m *AppManager) validateAppID() error {
+	if !m.app.DaprEnabled {
+		return nil
+	}
+
+	template := buildPodTemplateSpec(m.App())
+	if template.Annotations["dapr.io/app-id"] == "" {
+		return fmt.Errorf("dapr is enabled for %s but its dapr.io/app-id annotation is empty", m.app.AppName)
+	}
+
+	return nil
+}
+
+// firstRunningPod returns the first app pod which is running and not being deleted
+func (m *AppManager) firstRunningPod(ctx context.Context) (*apiv1.Pod, error) {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Status.Phase == apiv1.PodRunning && pod.DeletionTimestamp == nil {
+			return pod, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no running pods found for %s", m.app.AppName)
+}
+
+// sidecarImages returns the image of the dapr side car by pod name and fails if a pod has no side car
+func (m *AppManager) sidecarImages(ctx context.Context) (map[string]string, error) {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(podList.Items) == 0 {
+		return nil, fmt.Errorf("no pods found for %s", m.app.AppName)
+	}
+
+	images := map[string]string{}
+	for _, pod := range podList.Items {
+		// Pods being replaced by a rollout are ignored
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			if container.Name == DaprSideCarName {
+				images[pod.Name] = container.Image
+			}
+		}
+		if _, ok := images[pod.Name]; !ok {
+			return nil, fmt.Errorf("cannot find dapr sidecar in pod %s", pod.Name)
+		}
+	}
+
+	return images, nil
+}
+
+// rolloutPodTemplateAnnotation sets the annotation key on the pod template of the app workload
+// and waits until the new pods are ready and the old ones are gone.
+func (m *AppManager) rolloutPodTemplateAnnotation(ctx context.Context, key, value string) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, key, value)
+
+	if m.isStatefulSet() {
+		patched, err := m.client.StatefulSets(m.namespace).Patch(ctx, m.app.AppName, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+
+		_, err = m.WaitUntilStatefulSetStateWithContext(ctx, func(statefulSet *appsv1.StatefulSet, err error) bool {
+			return m.IsStatefulSetDone(statefulSet, err) && statefulSet.Status.ObservedGeneration >= patched.Generation
+		})
+		return err
+	}
+
+	generation, err := m.patchDeployment(ctx, []byte(patch))
+	if err != nil {
+		return err
+	}
+
+	// The old pods are gone once the new generation is observed and all replicas are updated and ready
+	_, err = m.WaitUntilDeploymentStateWithContext(ctx, func(deployment *appsv1.Deployment, err error) bool {
+		return m.IsDeploymentDone(deployment, err) &&
+			deployment.Status.ObservedGeneration >= generation &&
+			deployment.Status.UpdatedReplicas == m.replicas() &&
+			deployment.Status.Replicas == m.replicas()
+	})
+	return err
+}
+
+// PatchDeployment applies the strategic merge patch to the app deployment and returns the resulting generation,
+// which WaitForObservedGeneration takes to wait until the deployment controller has seen the change
+func (m *AppManager) PatchDeployment(patch []byte) (int64, error) {
+	return m.patchDeployment(context.TODO(), patch)
+}
+
+func (m *AppManager) patchDeployment(ctx context.Context, patch []byte) (int64, error) {
+	patched, err := m.client.Deployments(m.namespace).Patch(ctx, m.app.AppName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	return patched.Generation, nil
+}
+
+// WaitForObservedGeneration waits until the deployment controller has observed generation of the app deployment.
+// Checking IsDeploymentDone right after a patch may otherwise pass against the previous generation.
+func (m *AppManager) WaitForObservedGeneration(generation int64) error {
+	_, err := m.WaitUntilDeploymentState(func(deployment *appsv1.Deployment, err error) bool {
+		return err == nil && deployment.Status.ObservedGeneration >= generation
+	})
+	return err
+}
+
+// CreateHPA creates a HorizontalPodAutoscaler scaling the app workload between minReplicas and maxReplicas
+// on CPU utilization. It is deleted by Dispose.
+func (m *AppManager) CreateHPA(minReplicas, maxReplicas, targetCPUPercent int32) error {
+	if m.app.WorkloadType == WorkloadTypeJob {
+		return fmt.Errorf("job %q can't be autoscaled", m.app.AppName)
+	}
+	if minReplicas < 1 || maxReplicas < minReplicas {
+		return fmt.Errorf("invalid replica range %d-%d for %s", minReplicas, maxReplicas, m.app.AppName)
+	}
+
+	obj := buildHPAObject(m.namespace, m.App(), m.workloadKind(), minReplicas, maxReplicas, targetCPUPercent)
+	return m.createWithRetry(func() error {
+		_, err := m.client.HorizontalPodAutoscalers(m.namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		return err
+	})
+}
+
+// DeleteHPA deletes the HorizontalPodAutoscaler of the app, if any
+func (m *AppManager) DeleteHPA() error {
+	return m.deleteHPA(context.TODO())
+}
+
+func (m *AppManager) deleteHPA(ctx context.Context) error {
+	err := m.client.HorizontalPodAutoscalers(m.namespace).Delete(ctx, m.app.AppName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// GetCurrentReplicas returns the number of replicas the app workload currently runs,
+// which changes when the app is scaled by an autoscaler
+func (m *AppManager) GetCurrentReplicas() (int32, error) {
+	switch m.app.WorkloadType {
+	case WorkloadTypeStatefulSet:
+		statefulSet, err := m.client.StatefulSets(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return statefulSet.Status.Replicas, nil
+	case WorkloadTypeJob:
+		return 0, fmt.Errorf("job %q has no replicas", m.app.AppName)
+	}
+
+	deployment, err := m.client.Deployments(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	return deployment.Status.Replicas, nil
+}
+
+// ReplicaStatus is a snapshot of the replica counts of the app deployment
+type ReplicaStatus struct {
+	Desired     int32
+	Ready       int32
+	Available   int32
+	Updated     int32
+	Unavailable int32
+}
+
+// GetReplicaStatus returns the desired, ready, available, updated and unavailable replicas of the app deployment
+func (m *AppManager) GetReplicaStatus() (ReplicaStatus, error) {
+	deployment, err := m.client.Deployments(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return ReplicaStatus{}, err
+	}
+
+	status := ReplicaStatus{
+		Ready:       deployment.Status.ReadyReplicas,
+		Available:   deployment.Status.AvailableReplicas,
+		Updated:     deployment.Status.UpdatedReplicas,
+		Unavailable: deployment.Status.UnavailableReplicas,
+	}
+	if deployment.Spec.Replicas != nil {
+		status.Desired = *deployment.Spec.Replicas
+	}
+
+	return status, nil
+}
+
+// AppState aggregates the readiness signals of the app for logging on failures
+type AppState struct {
+	// Replicas is only filled for Deployments
+	Replicas ReplicaStatus
+	Pods     []PodState
+	// WarningEvents are the most recent Warning events of the app pods and workload, oldest first
+	WarningEvents []apiv1.Event
+}
+
+// PodState is the state of an app pod and its containers
+type PodState struct {
+	Name       string
+	NodeName   string
+	Phase      apiv1.PodPhase
+	Containers []ContainerState
+}
+
+// ContainerState is the state of a container of an app pod
+type ContainerState struct {
+	Name         string
+	Ready        bool
+	RestartCount int32
+	// State is running, waiting or terminated along with the reason, e.g. "waiting: CrashLoopBackOff"
+	State string
+}
+
+// String formats the state over multiple lines
+func (s AppState) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "replicas: desired %d, ready %d, available %d, updated %d, unavailable %d",
+		s.Replicas.Desired, s.Replicas.Ready, s.Replicas.Available, s.Replicas.Updated, s.Replicas.Unavailable)
+	for _, pod := range s.Pods {
+		fmt.Fprintf(&sb, "\npod %s on %q: %s", pod.Name, pod.NodeName, pod.Phase)
+		for _, container := range pod.Containers {
+			fmt.Fprintf(&sb, "\n  container %s: %s, ready: %t, restarts: %d", container.Name, container.State, container.Ready, container.RestartCount)
+		}
+	}
+	for _, event := range s.WarningEvents {
+		fmt.Fprintf(&sb, "\nevent %s %s: %s: %s", event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, event.Message)
+	}
+
+	return sb.String()
+}
+
+// DescribeState collects the replica status, the container states and restarts of the app pods and the recent
+// warning events in one call, e.g. to log them when a test fails
+func (m *AppManager) DescribeState() (AppState, error) {
+	ctx := context.TODO()
+	state := AppState{}
+
+	if m.workloadKind() == "Deployment" {
+		replicas, err := m.GetReplicaStatus()
+		if err != nil && !errors.IsNotFound(err) {
+			return AppState{}, err
+		}
+		state.Replicas = replicas
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return AppState{}, err
+	}
+
+	for _, pod := range podList.Items {
+		podState := PodState{
+			Name:     pod.Name,
+			NodeName: pod.Spec.NodeName,
+			Phase:    pod.Status.Phase,
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			podState.Containers = append(podState.Containers, ContainerState{
+				Name:         status.Name,
+				Ready:        status.Ready,
+				RestartCount: status.RestartCount,
+				State:        describeContainerState(status.State),
+			})
+		}
+		state.Pods = append(state.Pods, podState)
+	}
+
+	events, err := m.getEvents(ctx)
+	if err != nil {
+		return AppState{}, err
+	}
+	for _, event := range events {
+		if event.Type == apiv1.EventTypeWarning {
+			state.WarningEvents = append(state.WarningEvents, event)
+		}
+	}
+	if len(state.WarningEvents) > maxWarningEvents {
+		state.WarningEvents = state.WarningEvents[len(state.WarningEvents)-maxWarningEvents:]
+	}
+
+	return state, nil
+}
+
+// describeContainerState formats the state of a container along with its reason
+func describeContainerState(state apiv1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "running"
+	case state.Waiting != nil:
+		return "waiting: " + state.Waiting.Reason
+	case state.Terminated != nil:
+		return fmt.Sprintf("terminated: %s (exit code %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	default:
+		return "unknown"
+	}
+}
+
+// WaitForReplicaCount waits until the deployment has target ready replicas, e.g. after an HPA or
+// KEDA scaled the app. Unlike ScaleDeploymentReplica it doesn't change the replicas itself. The error reports the
+// last observed number of ready replicas when ctx is done or the poll timeout elapses first.
+func (m *AppManager) WaitForReplicaCount(ctx context.Context, target int32) error {
+	deploymentsClient := m.client.Deployments(m.namespace)
+
+	lastReady := int32(-1)
+
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		deployment, err := deploymentsClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		lastReady = deployment.Status.ReadyReplicas
+		return lastReady == target, nil
+	})
+
+	if waitErr != nil {
+		if lastReady < 0 {
+			return fmt.Errorf("deployment %q did not reach %d ready replicas: %s", m.app.AppName, target, waitErr)
+		}
+		return fmt.Errorf("deployment %q did not reach %d ready replicas, last ready: %d: %s", m.app.AppName, target, lastReady, waitErr)
+	}
+
+	return nil
+}
+
+// WaitForHPAScaleEvent waits until the app's HorizontalPodAutoscaler wants at least minReplicas
+// or the poll timeout elapses, and returns the HPA's current metrics so callers can assert on the scaling decision.
+func (m *AppManager) WaitForHPAScaleEvent(ctx context.Context, minReplicas int32) ([]autoscalingv2beta2.MetricStatus, error) {
+	hpaClient := m.client.HorizontalPodAutoscalers(m.namespace)
+
+	var lastHPA *autoscalingv2beta2.HorizontalPodAutoscaler
+
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastHPA, err = hpaClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		if err != nil {
+			lastHPA = nil
+			// HPA may not be created yet
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return lastHPA.Status.DesiredReplicas >= minReplicas, nil
+	})
+
+	if waitErr != nil {
+		if lastHPA == nil {
+			return nil, fmt.Errorf("hpa %q did not scale to %d replicas: %s", m.app.AppName, minReplicas, waitErr)
+		}
+		return nil, fmt.Errorf("hpa %q did not scale to %d replicas, desired: %d, conditions: %+v: %s", m.app.AppName, minReplicas, lastHPA.Status.DesiredReplicas, lastHPA.Status.Conditions, waitErr)
+	}
+
+	// Correlate the scaling decision with the events emitted by the HPA controller
+	events, err := m.client.Events(m.namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=HorizontalPodAutoscaler,involvedObject.name=%s", m.app.AppName),
+	})
+	if err != nil {
+		log.Printf("Failed to list events for hpa %s. Error was: %s", m.app.AppName, err)
+	} else {
+		for _, event := range events.Items {
+			if event.Reason == "SuccessfulRescale" {
+				log.Printf("HPA %s: %s", m.app.AppName, event.Message)
+			}
+		}
+	}
+
+	return lastHPA.Status.CurrentMetrics, nil
+}
+
+// CreateIngressService creates Ingress endpoint for test app
+func (m *AppManager) CreateIngressService() (*apiv1.Service, error) {
+	return m.createIngressService(context.TODO())
+}
+
+func (m *AppManager) createIngressService(ctx context.Context) (*apiv1.Service, error) {
+	serviceClient := m.client.Services(m.namespace)
+	obj := buildServiceObject(m.namespace, m.App())
+
+	var result *apiv1.Service
+	err := m.createWithRetry(func() error {
+		var err error
+		result, err = serviceClient.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AcquireExternalURL gets external ingress endpoint from service when it is ready
+func (m *AppManager) AcquireExternalURL() string {
+	log.Printf("Waiting until service ingress is ready for %s...\n", m.app.AppName)
+	svc, err := m.WaitUntilServiceState(m.IsServiceIngressReady)
+	if err != nil {
+		return ""
+	}
+
+	log.Printf("Service ingress for %s is ready...\n", m.app.AppName)
+	return m.AcquireExternalURLFromService(svc)
+}
+
+// GetServiceDNSName returns the DNS name of the app service inside the cluster, e.g. testapp.apputil-test.svc,
+// for callers running in another pod. Use AcquireExternalURL from outside the cluster.
+func (m *AppManager) GetServiceDNSName() string {
+	return fmt.Sprintf("%s.%s.svc", m.app.AppName, m.namespace)
+}
+
+// GetClusterIP returns the cluster IP of the app service
+func (m *AppManager) GetClusterIP() (string, error) {
+	svc, err := m.client.Services(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == apiv1.ClusterIPNone {
+		return "", fmt.Errorf("service %q has no cluster IP", m.app.AppName)
+	}
+
+	return svc.Spec.ClusterIP, nil
+}
+
+// AcquireExternalURLForPort gets the external ingress endpoint for the service port targetPort when it is ready
+func (m *AppManager) AcquireExternalURLForPort(targetPort int) string {
+	log.Printf("Waiting until service ingress is ready for %s...\n", m.app.AppName)
+	svc, err := m.WaitUntilServiceState(m.IsServiceIngressReady)
+	if err != nil {
+		return ""
+	}
+
+	for i, port := range svc.Spec.Ports {
+		if int(port.Port) == targetPort {
+			return m.externalURLForServicePort(svc, i)
+		}
+	}
+
+	log.Printf("Service %s doesn't expose port %d\n", m.app.AppName, targetPort)
+	return ""
+}
+
+// AcquireExternalURLForPortName gets the external ingress endpoint for the service port named name when it is
+// ready, e.g. a port declared in AppDescription.Ports
+func (m *AppManager) AcquireExternalURLForPortName(name string) string {
+	log.Printf("Waiting until service ingress is ready for %s...\n", m.app.AppName)
+	svc, err := m.WaitUntilServiceState(m.IsServiceIngressReady)
+	if err != nil {
+		return ""
+	}
+
+	for i, port := range svc.Spec.Ports {
+		if port.Name == name {
+			return m.externalURLForServicePort(svc, i)
+		}
+	}
+
+	log.Printf("Service %s doesn't expose port %s\n", m.app.AppName, name)
+	return ""
+}
+
+// WaitUntilServiceState waits until isState returns true
+//
+// Deprecated: use WaitUntilServiceStateWithContext to propagate test deadlines and cancellation.
+func (m *AppManager) WaitUntilServiceState(isState func(*apiv1.Service, error) bool) (*apiv1.Service, error) {
+	return m.WaitUntilServiceStateWithContext(context.Background(), isState)
+}
+
+// WaitUntilServiceStateWithContext waits until isState returns true, the poll timeout elapses or ctx is done
+func (m *AppManager) WaitUntilServiceStateWithContext(ctx context.Context, isState func(*apiv1.Service, error) bool) (*apiv1.Service, error) {
+	serviceClient := m.client.Services(m.namespace)
+	var lastService *apiv1.Service
+
+	start := time.Now()
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastService, err = serviceClient.Get(ctx, m.app.AppName, metav1.GetOptions{})
+		done := isState(lastService, err)
+		if !done && err != nil {
+			return true, err
+		}
+
+		return done, nil
+	})
+
+	if waitErr == wait.ErrWaitTimeout {
+		return lastService, &ServiceTimeoutError{
+			AppName:     m.app.AppName,
+			LastService: lastService,
+			Elapsed:     time.Since(start),
+			Diagnostics: m.serviceDiagnostics(lastService),
+		}
+	}
+	if waitErr != nil {
+		return lastService, fmt.Errorf("service %q is not in desired state, received: %+v: %s%s", m.app.AppName, lastService, waitErr, m.serviceDiagnostics(lastService))
+	}
+
+	return lastService, nil
+}
+
+// serviceDiagnostics returns the load balancer state and the most recent events of the app service formatted
+// for an error message, e.g. to tell a SyncLoadBalancerFailed apart from slow provisioning.
+// Failures to collect the events are logged and only the load balancer state is returned.
+func (m *AppManager) serviceDiagnostics(svc *apiv1.Service) string {
+	var sb strings.Builder
+	if svc != nil && svc.Spec.Type == apiv1.ServiceTypeLoadBalancer {
+		fmt.Fprintf(&sb, "\nload balancer ingress: %+v", svc.Status.LoadBalancer.Ingress)
+	}
+
+	// The caller's context may already be expired, so use a fresh one bounded by diagnosticsTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	eventList, err := m.client.Events(m.namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=Service,involvedObject.name=%s", m.app.AppName),
+	})
+	if err != nil {
+		log.Printf("Failed to list events for service %s. Error was: %s", m.app.AppName, err)
+		return sb.String()
+	}
+
+	events := []apiv1.Event{}
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Kind == "Service" && event.InvolvedObject.Name == m.app.AppName {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		return sb.String()
+	}
+
+	// Most recent events first
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[j].LastTimestamp.Before(&events[i].LastTimestamp)
+	})
+	if len(events) > maxWarningEvents {
+		events = events[:maxWarningEvents]
+	}
+
+	sb.WriteString("\nrecent service events:")
+	for _, event := range events {
+		fmt.Fprintf(&sb, "\n  %s: %s", event.Reason, event.Message)
+	}
+
+	return sb.String()
+}
+
+// AcquireExternalURLFromService gets external url from Service Object.
+func (m *AppManager) AcquireExternalURLFromService(svc *apiv1.Service) string {
+	return m.externalURLForServicePort(svc, 0)
+}
+
+// externalURLForServicePort gets external url of the i-th port of Service Object.
+func (m *AppManager) externalURLForServicePort(svc *apiv1.Service, i int) string {
+	if svc.Status.LoadBalancer.Ingress != nil && len(svc.Status.LoadBalancer.Ingress) > 0 && len(svc.Spec.Ports) > i {
+		address := ""
+		if svc.Status.LoadBalancer.Ingress[0].Hostname != "" {
+			address = svc.Status.LoadBalancer.Ingress[0].Hostname
+		} else {
+			address = svc.Status.LoadBalancer.Ingress[0].IP
+		}
+		return fmt.Sprintf("%s:%d", address, svc.Spec.Ports[i].Port)
+	}
+
+	// TODO: Support the other local k8s clusters
+	if minikubeExternalIP := m.minikubeNodeIP(); minikubeExternalIP != "" {
+		// if test cluster is minikube, external ip address is minikube node address
+		if len(svc.Spec.Ports) > i {
+			return fmt.Sprintf("%s:%d", minikubeExternalIP, svc.Spec.Ports[i].NodePort)
+		}
+	}
+
+	return ""
+}
+
+// IsServiceIngressReady returns true if external ip is available
+func (m *AppManager) IsServiceIngressReady(svc *apiv1.Service, err error) bool {
 	if err != nil || svc == nil {
 		return false
 	}
 
-	if svc.Status.LoadBalancer.Ingress != nil && len(svc.Status.LoadBalancer.Ingress) > 0 {
-		return true
+	if svc.Status.LoadBalancer.Ingress != nil && len(svc.Status.LoadBalancer.Ingress) > 0 {
+		return true
+	}
+
+	// TODO: Support the other local k8s clusters
+	if m.minikubeNodeIP() != "" {
+		if len(svc.Spec.Ports) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsServiceDeleted returns true if service does not exist
+func (m *AppManager) IsServiceDeleted(svc *apiv1.Service, err error) bool {
+	return err != nil && errors.IsNotFound(err)
+}
+
+func (m *AppManager) minikubeNodeIP() string {
+	// if you are running the test in minikube environment, DAPR_TEST_MINIKUBE_IP environment variable must be
+	// minikube cluster IP address from the output of `minikube ip` command
+
+	// TODO: Use the better way to get the node ip of minikube
+	return os.Getenv(MiniKubeIPEnvVar)
+}
+
+// DeleteDeployment deletes deployment for the test app
+func (m *AppManager) DeleteDeployment(ignoreNotFound bool) error {
+	return m.deleteDeployment(context.TODO(), ignoreNotFound)
+}
+
+func (m *AppManager) deleteDeployment(ctx context.Context, ignoreNotFound bool) error {
+	deploymentsClient := m.client.Deployments(m.namespace)
+	deletePolicy := metav1.DeletePropagationForeground
+
+	if err := deploymentsClient.Delete(ctx, m.app.AppName, metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteStatefulSet deletes StatefulSet for the test app
+func (m *AppManager) DeleteStatefulSet(ignoreNotFound bool) error {
+	return m.deleteStatefulSet(context.TODO(), ignoreNotFound)
+}
+
+func (m *AppManager) deleteStatefulSet(ctx context.Context, ignoreNotFound bool) error {
+	statefulSetsClient := m.client.StatefulSets(m.namespace)
+	deletePolicy := metav1.DeletePropagationForeground
+
+	if err := statefulSetsClient.Delete(ctx, m.app.AppName, metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteJob deletes Job for the test app together with its pods
+func (m *AppManager) DeleteJob(ignoreNotFound bool) error {
+	return m.deleteJob(context.TODO(), ignoreNotFound)
+}
+
+func (m *AppManager) deleteJob(ctx context.Context, ignoreNotFound bool) error {
+	jobsClient := m.client.Jobs(m.namespace)
+	deletePolicy := metav1.DeletePropagationForeground
+
+	if err := jobsClient.Delete(ctx, m.app.AppName, metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteService deletes deployment for the test app
+func (m *AppManager) DeleteService(ignoreNotFound bool) error {
+	return m.deleteService(context.TODO(), ignoreNotFound)
+}
+
+func (m *AppManager) deleteService(ctx context.Context, ignoreNotFound bool) error {
+	serviceClient := m.client.Services(m.namespace)
+	deletePolicy := metav1.DeletePropagationForeground
+
+	if err := serviceClient.Delete(ctx, m.app.AppName, metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
+		return err
+	}
+
+	return nil
+}
+
+// GetOrCreateNamespace gets or creates namespace unless namespace exists
+func (m *AppManager) GetOrCreateNamespace() (*apiv1.Namespace, error) {
+	return m.getOrCreateNamespace(context.TODO())
+}
+
+func (m *AppManager) getOrCreateNamespace(ctx context.Context) (*apiv1.Namespace, error) {
+	namespaceClient := m.client.Namespaces()
+	ns, err := namespaceClient.Get(ctx, m.namespace, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		obj := buildNamespaceObject(m.namespace)
+		ns, err = namespaceClient.Create(ctx, obj, metav1.CreateOptions{})
+		if err == nil {
+			m.createdNamespace = true
+		}
+		return ns, err
+	}
+
+	return ns, err
+}
+
+// requireNamespace returns an error if the app namespace doesn't exist
+func (m *AppManager) requireNamespace(ctx context.Context) error {
+	_, err := m.client.Namespaces().Get(ctx, m.namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("namespace %q of %s doesn't exist and must be provisioned before the test", m.namespace, m.app.AppName)
+	}
+
+	return err
+}
+
+// CreateServiceAccount creates a ServiceAccount in the app namespace so it can be used as ServiceAccountName
+func (m *AppManager) CreateServiceAccount(name string) (*apiv1.ServiceAccount, error) {
+	obj := buildServiceAccountObject(m.namespace, name)
+	return m.client.ServiceAccounts(m.namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+}
+
+// DeleteServiceAccount deletes a ServiceAccount from the app namespace
+func (m *AppManager) DeleteServiceAccount(name string, ignoreNotFound bool) error {
+	err := m.client.ServiceAccounts(m.namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && (!ignoreNotFound || !errors.IsNotFound(err)) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteNamespace deletes the app namespace and, if wait is true, waits until it is gone
+func (m *AppManager) DeleteNamespace(wait bool) error {
+	return m.deleteNamespace(context.TODO(), wait)
+}
+
+func (m *AppManager) deleteNamespace(ctx context.Context, waitDeleted bool) error {
+	namespaceClient := m.client.Namespaces()
+
+	if err := namespaceClient.Delete(ctx, m.namespace, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	m.createdNamespace = false
+
+	if !waitDeleted {
+		return nil
+	}
+
+	var lastNamespace *apiv1.Namespace
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		lastNamespace, err = namespaceClient.Get(ctx, m.namespace, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		return false, nil
+	})
+
+	if waitErr != nil {
+		return fmt.Errorf("namespace %q is not deleted, received: %+v: %s", m.namespace, lastNamespace, waitErr)
+	}
+
+	return nil
+}
+
+// GetHostDetails returns the name and IP address of the pods running the app
+func (m *AppManager) GetHostDetails() ([]PodInfo, error) {
+	podClient := m.client.Pods(m.namespace)
+
+	// Filter only 'testapp=appName' labeled Pods
+	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := m.replicas()
+	if len(podList.Items) != int(replicas) {
+		return nil, fmt.Errorf("expected number of pods for %s: %d, received: %d", m.app.AppName, replicas, len(podList.Items))
+	}
+
+	result := make([]PodInfo, 0, len(podList.Items))
+	for _, item := range podList.Items {
+		result = append(result, podInfo(item))
+	}
+
+	return result, nil
+}
+
+// CreatePDB creates a PodDisruptionBudget keeping minAvailable app pods, either a number or a percentage,
+// available during voluntary disruptions such as EvictPod. It is deleted by Dispose.
+func (m *AppManager) CreatePDB(minAvailable intstr.IntOrString) error {
+	obj := buildPDBObject(m.namespace, m.App(), minAvailable)
+	return m.createWithRetry(func() error {
+		_, err := m.client.PodDisruptionBudgets(m.namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		return err
+	})
+}
+
+// DeletePDB deletes the PodDisruptionBudget of the app, if any
+func (m *AppManager) DeletePDB() error {
+	return m.deletePDB(context.TODO())
+}
+
+func (m *AppManager) deletePDB(ctx context.Context) error {
+	err := m.client.PodDisruptionBudgets(m.namespace).Delete(ctx, m.app.AppName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// CreateResourceQuota creates a ResourceQuota named after the app in the app namespace, e.g. to assert that the app
+// and its side cars fit into a constrained namespace. Create it before Init since quotas only apply to new pods.
+// Pods rejected by the quota are reported by WaitUntilDeploymentState. It is deleted by Dispose.
+func (m *AppManager) CreateResourceQuota(spec apiv1.ResourceQuotaSpec) error {
+	obj := buildResourceQuotaObject(m.namespace, m.App(), spec)
+	return m.createWithRetry(func() error {
+		_, err := m.client.ResourceQuotas(m.namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		return err
+	})
+}
+
+// GetResourceQuotaUsage returns the resources used in the app namespace as observed by the ResourceQuota of the app
+func (m *AppManager) GetResourceQuotaUsage() (apiv1.ResourceList, error) {
+	quota, err := m.client.ResourceQuotas(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return quota.Status.Used, nil
+}
+
+func (m *AppManager) deleteResourceQuota(ctx context.Context) error {
+	err := m.client.ResourceQuotas(m.namespace).Delete(ctx, m.app.AppName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// DeletePod deletes an app pod to simulate a failure. A pod which no longer exists is ignored,
+// so repeated chaos iterations don't fail.
+func (m *AppManager) DeletePod(podName string) error {
+	err := m.client.Pods(m.namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// EvictPod evicts an app pod through the eviction subresource, which respects PodDisruptionBudgets.
+// A pod which no longer exists is ignored.
+func (m *AppManager) EvictPod(podName string) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: m.namespace,
+		},
+	}
+
+	err := m.client.Pods(m.namespace).Evict(context.TODO(), eviction)
+	if errors.IsTooManyRequests(err) {
+		return fmt.Errorf("eviction of pod %s is blocked by a PodDisruptionBudget: %w", podName, err)
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// GetPodByIndex returns the StatefulSet pod with the given ordinal, e.g. 0 for <app>-0
+func (m *AppManager) GetPodByIndex(i int) (PodInfo, error) {
+	if !m.isStatefulSet() {
+		return PodInfo{}, fmt.Errorf("%s is not deployed as a StatefulSet", m.app.AppName)
+	}
+
+	name := fmt.Sprintf("%s-%d", m.app.AppName, i)
+	pod, err := m.client.Pods(m.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return PodInfo{}, fmt.Errorf("pod with ordinal %d of %s doesn't exist", i, m.app.AppName)
+		}
+		return PodInfo{}, err
+	}
+
+	return podInfo(*pod), nil
+}
+
+// GetNodeForPod returns the name of the node the given pod is scheduled to
+func (m *AppManager) GetNodeForPod(podName string) (string, error) {
+	pod, err := m.client.Pods(m.namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	if pod.Spec.NodeName == "" {
+		return "", fmt.Errorf("pod %s is not scheduled to a node yet", podName)
+	}
+
+	return pod.Spec.NodeName, nil
+}
+
+// GetContainerState returns the live state of a container of the given pod, including init containers
+func (m *AppManager) GetContainerState(podName, containerName string) (apiv1.ContainerState, error) {
+	return m.containerState(context.TODO(), podName, containerName)
+}
+
+func (m *AppManager) containerState(ctx context.Context, podName, containerName string) (apiv1.ContainerState, error) {
+	pod, err := m.client.Pods(m.namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return apiv1.ContainerState{}, err
+	}
+
+	statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name == containerName {
+			return status.State, nil
+		}
+	}
+
+	return apiv1.ContainerState{}, fmt.Errorf("no status of container %s in pod %s", containerName, podName)
+}
+
+// WaitForContainerState waits until isState returns true for the state of a container of the given pod,
+// e.g. Waiting with reason CrashLoopBackOff or Terminated with reason OOMKilled, the poll timeout elapses
+// or ctx is done
+func (m *AppManager) WaitForContainerState(ctx context.Context, podName, containerName string, isState func(apiv1.ContainerState) bool) (apiv1.ContainerState, error) {
+	var lastState apiv1.ContainerState
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		state, err := m.containerState(ctx, podName, containerName)
+		if err != nil {
+			// The container status may not be reported yet
+			return false, nil
+		}
+		lastState = state
+		return isState(state), nil
+	})
+
+	if waitErr != nil {
+		return lastState, fmt.Errorf("container %s of pod %s is not in desired state, received: %+v: %s", containerName, podName, lastState, waitErr)
 	}
 
-	// TODO: Support the other local k8s clusters
-	if m.minikubeNodeIP() != "" {
-		if len(svc.Spec.Ports) > 0 {
-			return true
+	return lastState, nil
+}
+
+// GetReadyEndpoints returns the IPs of the ready addresses behind the app service. Unlike GetHostDetails
+// it excludes pods which don't pass their readiness checks. An empty list is returned if the service
+// has no endpoints yet.
+func (m *AppManager) GetReadyEndpoints() ([]string, error) {
+	endpoints, err := m.client.Endpoints(m.namespace).Get(context.TODO(), m.app.AppName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return []string{}, nil
 		}
+		return nil, err
 	}
 
-	return false
+	ips := []string{}
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+
+	return ips, nil
 }
 
-// IsServiceDeleted returns true if service does not exist
-func (m *AppManager) IsServiceDeleted(svc *apiv1.Service, err error) bool {
-	return err != nil && errors.IsNotFound(err)
+// WaitUntilPodsRunning waits until every app pod is running with all containers ready, independent of
+// the workload status. On timeout the error names the pods which are not ready and their container states.
+func (m *AppManager) WaitUntilPodsRunning() ([]PodInfo, error) {
+	podClient := m.client.Pods(m.namespace)
+
+	var notReady []string
+	var pods []PodInfo
+
+	ctx := context.TODO()
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		podList, err := podClient.List(ctx, metav1.ListOptions{
+			LabelSelector: m.appLabelSelector(),
+		})
+		if err != nil {
+			return false, err
+		}
+
+		notReady = nil
+		pods = nil
+		for _, pod := range podList.Items {
+			if reason := podNotReadyReason(pod); reason != "" {
+				notReady = append(notReady, fmt.Sprintf("pod %s: %s", pod.GetName(), reason))
+				continue
+			}
+			pods = append(pods, podInfo(pod))
+		}
+
+		return len(podList.Items) > 0 && len(notReady) == 0, nil
+	})
+
+	if waitErr != nil {
+		if len(notReady) == 0 {
+			return nil, fmt.Errorf("no running pods found for %s: %s", m.app.AppName, waitErr)
+		}
+		return nil, fmt.Errorf("pods of %s are not running: %s\n  %s", m.app.AppName, waitErr, strings.Join(notReady, "\n  "))
+	}
+
+	return pods, nil
 }
 
-func (m *AppManager) minikubeNodeIP() string {
-	// if you are running the test in minikube environment, DAPR_TEST_MINIKUBE_IP environment variable must be
-	// minikube cluster IP address from the output of `minikube ip` command
+// podNotReadyReason returns why pod is not running with all containers ready, or an empty string if it is
+func podNotReadyReason(pod apiv1.Pod) string {
+	if pod.Status.Phase != apiv1.PodRunning {
+		return fmt.Sprintf("phase %s", pod.Status.Phase)
+	}
+
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return fmt.Sprintf("%d of %d container statuses reported", len(pod.Status.ContainerStatuses), len(pod.Spec.Containers))
+	}
+
+	var states []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			continue
+		}
+		switch {
+		case status.State.Waiting != nil:
+			states = append(states, fmt.Sprintf("%s waiting: %s", status.Name, strings.TrimSpace(status.State.Waiting.Reason+" "+status.State.Waiting.Message)))
+		case status.State.Terminated != nil:
+			states = append(states, fmt.Sprintf("%s terminated: %s (exit code %d)", status.Name, status.State.Terminated.Reason, status.State.Terminated.ExitCode))
+		default:
+			states = append(states, fmt.Sprintf("%s not ready", status.Name))
+		}
+	}
+
+	return strings.Join(states, ", ")
+}
+
+// appLabelSelector returns the label selector of the app pods
+func (m *AppManager) appLabelSelector() string {
+	return fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName)
+}
+
+// GetPodsBySelector returns the pods in the app namespace matching both the app's LabelSelector and selector.
+// Empty selectors are ignored, and if both are empty the app pods are returned.
+func (m *AppManager) GetPodsBySelector(selector string) ([]PodInfo, error) {
+	composed := joinLabelSelectors(m.app.LabelSelector, selector)
+	if composed == "" {
+		composed = m.appLabelSelector()
+	}
+
+	if _, err := labels.Parse(composed); err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %s", composed, err)
+	}
+
+	podList, err := m.client.Pods(m.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: composed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []PodInfo{}
+	for _, pod := range podList.Items {
+		pods = append(pods, podInfo(pod))
+	}
+
+	return pods, nil
+}
+
+// joinLabelSelectors combines the non empty selectors into a single selector requiring all of them
+func joinLabelSelectors(selectors ...string) string {
+	parts := []string{}
+	for _, selector := range selectors {
+		selector = strings.Trim(strings.TrimSpace(selector), ",")
+		if selector != "" {
+			parts = append(parts, selector)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// GetNewestPod returns the most recently created pod of the app
+func (m *AppManager) GetNewestPod(ctx context.Context) (PodInfo, error) {
+	pods, err := m.getPodsByCreation(ctx)
+	if err != nil {
+		return PodInfo{}, err
+	}
+
+	return podInfo(pods[len(pods)-1]), nil
+}
+
+// GetOldestPod returns the earliest created pod of the app
+func (m *AppManager) GetOldestPod(ctx context.Context) (PodInfo, error) {
+	pods, err := m.getPodsByCreation(ctx)
+	if err != nil {
+		return PodInfo{}, err
+	}
+
+	return podInfo(pods[0]), nil
+}
+
+// getPodsByCreation returns the app pods sorted from the oldest to the newest
+func (m *AppManager) getPodsByCreation(ctx context.Context) ([]apiv1.Pod, error) {
+	podClient := m.client.Pods(m.namespace)
+
+	// Filter only 'testapp=appName' labeled Pods
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(podList.Items) == 0 {
+		return nil, fmt.Errorf("no pods found for app %s in namespace %s", m.app.AppName, m.namespace)
+	}
+
+	pods := podList.Items
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+
+	return pods, nil
+}
+
+func podInfo(pod apiv1.Pod) PodInfo {
+	return PodInfo{
+		Name:     pod.GetName(),
+		IP:       pod.Status.PodIP,
+		NodeName: pod.Spec.NodeName,
+	}
+}
+
+// SaveContainerLogs get container logs for all containers in the pod and saves them to disk
+func (m *AppManager) SaveContainerLogs() error {
+	return m.saveContainerLogs(context.TODO())
+}
+
+func (m *AppManager) saveContainerLogs(ctx context.Context) error {
+	podClient := m.client.Pods(m.namespace)
+
+	// Filter only 'testapp=appName' labeled Pods
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if m.app.SaveContainerLogsSnapshots {
+		m.lock.Lock()
+		m.logSnapshot++
+		m.lock.Unlock()
+	}
+
+	var files []string
+	if m.app.SaveContainerLogsArchive {
+		var filename string
+		filename, err = m.saveLogArchive(ctx, podList.Items)
+		if filename != "" {
+			files = append(files, filename)
+		}
+	} else {
+		files, err = m.saveLogsOfPods(ctx, podList.Items, true)
+	}
+
+	if m.app.SaveContainerLogsSnapshots {
+		m.pruneLogSnapshots(files)
+	}
+
+	return err
+}
+
+// logFileSuffix returns the sequence number suffix of the saved log files if snapshots are enabled
+func (m *AppManager) logFileSuffix() string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.logSnapshot == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(".%04d", m.logSnapshot)
+}
+
+// pruneLogSnapshots records the files of the latest log snapshot and deletes the files of the oldest
+// snapshots beyond MaxContainerLogSnapshots
+func (m *AppManager) pruneLogSnapshots(files []string) {
+	m.lock.Lock()
+	m.logSnapshotFiles = append(m.logSnapshotFiles, files)
+	var pruned [][]string
+	if keep := m.app.MaxContainerLogSnapshots; keep > 0 && len(m.logSnapshotFiles) > keep {
+		pruned = m.logSnapshotFiles[:len(m.logSnapshotFiles)-keep]
+		m.logSnapshotFiles = m.logSnapshotFiles[len(m.logSnapshotFiles)-keep:]
+	}
+	m.lock.Unlock()
+
+	for _, snapshot := range pruned {
+		for _, filename := range snapshot {
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete old container logs %s. Error was: %s", filename, err)
+			}
+		}
+	}
+}
+
+// DownloadAllLogsToArchive writes the current logs of all app containers, and the previous logs of restarted
+// containers, to w as a gzip compressed tarball with entries named <pod>/<container>.log. Each log is
+// streamed through a temporary file, so it isn't held in memory. Failed containers are skipped and the first
+// error is returned.
+func (m *AppManager) DownloadAllLogsToArchive(ctx context.Context, w io.Writer) error {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.writeLogArchive(ctx, w, podList.Items)
+}
+
+// saveLogArchive saves the logs of pods to a single <app>.logs.tar.gz file and returns the file name
+func (m *AppManager) saveLogArchive(ctx context.Context, pods []apiv1.Pod) (string, error) {
+	filename := fmt.Sprintf("%s/%s%s.logs.tar.gz", m.containerLogPrefix(), m.app.AppName, m.logFileSuffix())
+	fh, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	if err := m.writeLogArchive(ctx, fh, pods); err != nil {
+		return filename, err
+	}
+
+	log.Printf("Saved container logs to %s", filename)
+	return filename, nil
+}
+
+// writeLogArchive writes the current and previous container logs of pods to w as a gzip compressed tarball
+func (m *AppManager) writeLogArchive(ctx context.Context, w io.Writer, pods []apiv1.Pod) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	var firstErr error
+	add := func(podName, containerName string, previous bool) {
+		err := m.addLogToArchive(ctx, tw, podName, containerName, previous)
+		if err != nil {
+			log.Printf("Failed to archive container logs of %s/%s. Error was: %s", podName, containerName, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			add(pod.GetName(), container.Name, false)
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.RestartCount > 0 {
+				add(pod.GetName(), status.Name, true)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+
+	return firstErr
+}
+
+// addLogToArchive streams a container log to a temporary file, which gives the size of the tar entry,
+// and copies it into tw
+func (m *AppManager) addLogToArchive(ctx context.Context, tw *tar.Writer, podName, containerName string, previous bool) error {
+	podLogs, err := m.client.Pods(m.namespace).GetLogs(podName, &apiv1.PodLogOptions{
+		Container: containerName,
+		Previous:  previous,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer podLogs.Close()
+
+	tmp, err := ioutil.TempFile("", "container-log-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if m.app.SaveContainerLogsJSONL {
+		err = writeJSONLLogs(tmp, podLogs, podName, containerName)
+	} else {
+		_, err = io.Copy(tmp, podLogs)
+	}
+	if err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    fmt.Sprintf("%s/%s.%s", podName, containerName, m.containerLogExt(previous)),
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, tmp)
+
+	return err
+}
+
+// containerLogExt returns the file extension of saved container logs
+func (m *AppManager) containerLogExt(previous bool) string {
+	ext := "log"
+	if m.app.SaveContainerLogsJSONL {
+		ext = "jsonl"
+	}
+	if previous {
+		ext = "previous." + ext
+	}
+
+	return ext
+}
+
+// GetPreviousContainerLogs saves the logs of the previous instance of every restarted app container
+// to a .previous.log file, which holds the error of a crashed container. Containers which never
+// restarted are skipped.
+func (m *AppManager) GetPreviousContainerLogs() error {
+	ctx := context.TODO()
+
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.saveLogsOfPods(ctx, podList.Items, false)
+	return err
+}
+
+// GetPodLogsSince returns the logs written by container of pod podName since the given time, e.g. around a failure.
+// An empty podName selects the first running app pod and an empty container the app container.
+func (m *AppManager) GetPodLogsSince(podName, container string, since time.Time) (string, error) {
+	sinceTime := metav1.NewTime(since)
+	return m.getPodLogs(context.TODO(), podName, container, &apiv1.PodLogOptions{SinceTime: &sinceTime})
+}
+
+// GetPodLogsTail returns the last lines of the logs of container of pod podName.
+// An empty podName selects the first running app pod and an empty container the app container.
+func (m *AppManager) GetPodLogsTail(podName, container string, lines int64) (string, error) {
+	return m.getPodLogs(context.TODO(), podName, container, &apiv1.PodLogOptions{TailLines: &lines})
+}
+
+// getPodLogs returns the logs of container of pod podName selected by opts, defaulting to the app container
+// of the first running app pod
+func (m *AppManager) getPodLogs(ctx context.Context, podName, container string, opts *apiv1.PodLogOptions) (string, error) {
+	if podName == "" {
+		pod, err := m.firstRunningPod(ctx)
+		if err != nil {
+			return "", err
+		}
+		podName = pod.Name
+	}
+
+	opts.Container = container
+	if opts.Container == "" {
+		opts.Container = m.app.AppName
+	}
+
+	podLogs, err := m.client.Pods(m.namespace).GetLogs(podName, opts).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer podLogs.Close()
+
+	content, err := ioutil.ReadAll(podLogs)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// containerLogManifest describes the container logs saved for an app in a run
+type containerLogManifest struct {
+	App       string              `json:"app"`
+	Namespace string              `json:"namespace"`
+	Timestamp time.Time           `json:"timestamp"`
+	Logs      []containerLogEntry `json:"logs"`
+}
+
+// containerLogEntry describes a single saved container log, or the error saving it
+type containerLogEntry struct {
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	Previous  bool      `json:"previous,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// saveLogsOfPods saves the previous logs of restarted containers of pods and, if current is true,
+// the current logs of all their containers and the log manifest if it is enabled. It returns the saved files.
+func (m *AppManager) saveLogsOfPods(ctx context.Context, pods []apiv1.Pod, current bool) ([]string, error) {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+
+		entriesLock sync.Mutex
+		entries     []containerLogEntry
+		files       []string
+	)
+
+	// Bound the number of concurrent log downloads, a failed download doesn't stop the others
+	sem := make(chan struct{}, maxLogWorkers)
+	save := func(podName, containerName string, previous bool) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			entry := containerLogEntry{
+				Pod:       podName,
+				Container: containerName,
+				Previous:  previous,
+			}
+
+			filename, err := m.saveContainerLog(ctx, podName, containerName, previous)
+			if err != nil {
+				log.Printf("Failed to save container logs of %s/%s. Error was: %s", podName, containerName, err)
+				errOnce.Do(func() { firstErr = err })
+				entry.Error = err.Error()
+			} else {
+				entry.File = filepath.Base(filename)
+			}
+			entry.Timestamp = time.Now().UTC()
+
+			entriesLock.Lock()
+			entries = append(entries, entry)
+			if filename != "" {
+				files = append(files, filename)
+			}
+			entriesLock.Unlock()
+		}()
+	}
+
+	for _, pod := range pods {
+		if current {
+			for _, container := range pod.Spec.Containers {
+				save(pod.GetName(), container.Name, false)
+			}
+		}
+
+		// Previous logs only exist for restarted containers
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.RestartCount > 0 {
+				save(pod.GetName(), status.Name, true)
+			}
+		}
+	}
+	wg.Wait()
+
+	if current && m.app.SaveContainerLogsManifest {
+		filename, err := m.writeLogManifest(entries)
+		if err != nil {
+			log.Printf("Failed to write container log manifest for %s. Error was: %s", m.app.AppName, err)
+			errOnce.Do(func() { firstErr = err })
+		} else {
+			files = append(files, filename)
+		}
+	}
 
-	// TODO: Use the better way to get the node ip of minikube
-	return os.Getenv(MiniKubeIPEnvVar)
+	return files, firstErr
 }
 
-// DeleteDeployment deletes deployment for the test app
-func (m *AppManager) DeleteDeployment(ignoreNotFound bool) error {
-	deploymentsClient := m.client.Deployments(m.namespace)
-	deletePolicy := metav1.DeletePropagationForeground
+// writeLogManifest writes the manifest of the saved container logs next to them and returns its file name
+func (m *AppManager) writeLogManifest(entries []containerLogEntry) (string, error) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Pod != entries[j].Pod {
+			return entries[i].Pod < entries[j].Pod
+		}
+		if entries[i].Container != entries[j].Container {
+			return entries[i].Container < entries[j].Container
+		}
+		return !entries[i].Previous && entries[j].Previous
+	})
 
-	if err := deploymentsClient.Delete(context.TODO(), m.app.AppName, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
-	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
-		return err
+	manifest := containerLogManifest{
+		App:       m.app.AppName,
+		Namespace: m.namespace,
+		Timestamp: time.Now().UTC(),
+		Logs:      entries,
 	}
 
-	return nil
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	filename := fmt.Sprintf("%s/%s%s.manifest.json", m.containerLogPrefix(), m.app.AppName, m.logFileSuffix())
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		return "", err
+	}
+
+	log.Printf("Saved container log manifest to %s", filename)
+	return filename, nil
 }
 
-// DeleteService deletes deployment for the test app
-func (m *AppManager) DeleteService(ignoreNotFound bool) error {
-	serviceClient := m.client.Services(m.namespace)
-	deletePolicy := metav1.DeletePropagationForeground
+// saveContainerLog saves the current or previous logs of a single container to a file named after the pod and container
+// and returns the file name
+func (m *AppManager) saveContainerLog(ctx context.Context, podName, containerName string, previous bool) (string, error) {
+	req := m.client.Pods(m.namespace).GetLogs(podName, &apiv1.PodLogOptions{
+		Container: containerName,
+		Previous:  previous,
+	})
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer podLogs.Close()
 
-	if err := serviceClient.Delete(context.TODO(), m.app.AppName, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
-	}); err != nil && (ignoreNotFound && !errors.IsNotFound(err)) {
-		return err
+	filename := fmt.Sprintf("%s/%s.%s%s.%s", m.containerLogPrefix(), podName, containerName, m.logFileSuffix(), m.containerLogExt(previous))
+	fh, err := os.Create(filename)
+	if err != nil {
+		return "", err
 	}
+	defer fh.Close()
 
-	return nil
+	if m.app.SaveContainerLogsJSONL {
+		err = writeJSONLLogs(fh, podLogs, podName, containerName)
+	} else {
+		_, err = io.Copy(fh, podLogs)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Saved container logs to %s", filename)
+	return filename, nil
 }
 
-// GetOrCreateNamespace gets or creates namespace unless namespace exists
-func (m *AppManager) GetOrCreateNamespace() (*apiv1.Namespace, error) {
-	namespaceClient := m.client.Namespaces()
-	ns, err := namespaceClient.Get(context.TODO(), m.namespace, metav1.GetOptions{})
+// GetLogsContaining returns every line in the current logs of all app containers which contains substring.
+// Each line is prefixed with the pod and container name, and matches from different replicas are all kept.
+func (m *AppManager) GetLogsContaining(substring string) ([]string, error) {
+	return m.getLogsContaining(context.TODO(), substring)
+}
 
-	if err != nil && errors.IsNotFound(err) {
-		obj := buildNamespaceObject(m.namespace)
-		ns, err = namespaceClient.Create(context.TODO(), obj, metav1.CreateOptions{})
-		return ns, err
+// WaitForLogLine polls the app container logs until a line containing substring appears, ctx is done or the poll
+// timeout elapses. The error includes the log lines seen by the last poll.
+func (m *AppManager) WaitForLogLine(ctx context.Context, substring string) ([]string, error) {
+	var matches, seen []string
+
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		var err error
+		matches, seen, err = m.getLogLines(ctx, substring)
+		if err != nil {
+			return false, err
+		}
+		return len(matches) > 0, nil
+	})
+
+	if waitErr != nil {
+		return nil, fmt.Errorf("log line containing %q not found for app %s: %s, lines seen so far:\n%s", substring, m.app.AppName, waitErr, strings.Join(seen, "\n"))
 	}
 
-	return ns, err
+	return matches, nil
 }
 
-// GetHostDetails returns the name and IP address of the pods running the app
-func (m *AppManager) GetHostDetails() ([]PodInfo, error) {
-	if !m.app.DaprEnabled {
-		return nil, fmt.Errorf("dapr is not enabled for this app")
-	}
+func (m *AppManager) getLogsContaining(ctx context.Context, substring string) ([]string, error) {
+	matches, _, err := m.getLogLines(ctx, substring)
+	return matches, err
+}
 
+// getLogLines returns the lines in the current logs of all app containers which contain substring and all the
+// non empty lines, both prefixed with the pod and container name
+func (m *AppManager) getLogLines(ctx context.Context, substring string) ([]string, []string, error) {
 	podClient := m.client.Pods(m.namespace)
 
 	// Filter only 'testapp=appName' labeled Pods
-	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName),
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if len(podList.Items) != int(m.app.Replicas) {
-		return nil, fmt.Errorf("expected number of pods for %s: %d, received: %d", m.app.AppName, m.app.Replicas, len(podList.Items))
-	}
+	matches := []string{}
+	lines := []string{}
+	for _, pod := range podList.Items {
+		for _, container := range pod.Spec.Containers {
+			podLogs, err := podClient.GetLogs(pod.GetName(), &apiv1.PodLogOptions{
+				Container: container.Name,
+			}).DoRaw(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
 
-	result := make([]PodInfo, 0, len(podList.Items))
-	for _, item := range podList.Items {
-		result = append(result, PodInfo{
-			Name: item.GetName(),
-			IP:   item.Status.PodIP,
-		})
+			for _, line := range strings.Split(string(podLogs), "\n") {
+				prefixed := fmt.Sprintf("[%s/%s] %s", pod.GetName(), container.Name, line)
+				if strings.Contains(line, substring) {
+					matches = append(matches, prefixed)
+				}
+				if line != "" {
+					lines = append(lines, prefixed)
+				}
+			}
+		}
 	}
 
-	return result, nil
+	return matches, lines, nil
 }
 
-// SaveContainerLogs get container logs for all containers in the pod and saves them to disk
-func (m *AppManager) SaveContainerLogs() error {
-	if !m.app.DaprEnabled {
-		return fmt.Errorf("dapr is not enabled for this app")
-	}
-
+// StreamContainerLogs follows the logs of all containers in the app pods and copies them to w,
+// prefixing each line with the pod and container name. Streams of restarted containers are reopened.
+// It blocks until ctx is done or all the pods are gone.
+func (m *AppManager) StreamContainerLogs(ctx context.Context, w io.Writer) error {
 	podClient := m.client.Pods(m.namespace)
 
 	// Filter only 'testapp=appName' labeled Pods
-	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName),
+	podList, err := podClient.List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
 	})
 	if err != nil {
 		return err
 	}
 
+	out := &lockedWriter{w: w}
+
+	var wg sync.WaitGroup
 	for _, pod := range podList.Items {
 		for _, container := range pod.Spec.Containers {
-			err := func() error {
-				req := podClient.GetLogs(pod.GetName(), &apiv1.PodLogOptions{
-					Container: container.Name,
-				})
-				podLogs, err := req.Stream(context.TODO())
-				if err != nil {
-					return err
-				}
-				defer podLogs.Close()
+			wg.Add(1)
+			go func(podName, containerName string) {
+				defer wg.Done()
+				m.streamContainerLog(ctx, out, podName, containerName)
+			}(pod.GetName(), container.Name)
+		}
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// streamContainerLog follows the logs of a single container until ctx is done or the pod is deleted
+func (m *AppManager) streamContainerLog(ctx context.Context, w io.Writer, podName, containerName string) {
+	podClient := m.client.Pods(m.namespace)
+	prefix := fmt.Sprintf("[%s/%s] ", podName, containerName)
+	interval, _ := m.pollConfig()
+
+	var sinceTime *metav1.Time
+	for {
+		req := podClient.GetLogs(podName, &apiv1.PodLogOptions{
+			Container: containerName,
+			Follow:    true,
+			SinceTime: sinceTime,
+		})
 
-				filename := fmt.Sprintf("%s/%s.%s.log", m.logPrefix, pod.GetName(), container.Name)
-				fh, err := os.Create(filename)
-				if err != nil {
-					return err
+		podLogs, err := req.Stream(ctx)
+		if err == nil {
+			reader := bufio.NewReader(podLogs)
+			for {
+				line, rerr := reader.ReadString('\n')
+				if line != "" {
+					if !strings.HasSuffix(line, "\n") {
+						line += "\n"
+					}
+					io.WriteString(w, prefix+line)
 				}
-				defer fh.Close()
-				_, err = io.Copy(fh, podLogs)
-				if err != nil {
-					return err
+				if rerr != nil {
+					break
 				}
+			}
+			podLogs.Close()
+		} else if errors.IsNotFound(err) {
+			return
+		} else if ctx.Err() == nil {
+			log.Printf("Failed to stream logs for %s. Error was: %s", prefix, err)
+		}
 
-				log.Printf("Saved container logs to %s", filename)
-				return nil
-			}()
+		// The stream ends when the container restarts, so reopen it for the lines logged from now on
+		now := metav1.Now()
+		sinceTime = &now
 
-			if err != nil {
-				return err
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lockedWriter serializes writes from concurrent log streams
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// writeJSONLLogs copies the container logs from r to w as one JSON object per line.
+// JSON log lines get the pod, container and source under the "_meta" key, and any other line
+// is wrapped as {"raw": "..."}. Lines longer than maxLogLineSize are split into several records.
+func writeJSONLLogs(w io.Writer, r io.Reader, podName, containerName string) error {
+	source := "app"
+	if containerName == DaprSideCarName {
+		source = "sidecar"
+	}
+	meta := map[string]string{
+		"pod":       podName,
+		"container": containerName,
+		"source":    source,
+	}
+
+	reader := bufio.NewReaderSize(r, maxLogLineSize)
+	encoder := json.NewEncoder(w)
+
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			record := map[string]interface{}{}
+			if jerr := json.Unmarshal(trimmed, &record); jerr != nil || record == nil {
+				record = map[string]interface{}{"raw": string(trimmed)}
 			}
+			record["_meta"] = meta
+
+			if eerr := encoder.Encode(record); eerr != nil {
+				return eerr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
 		}
 	}
+}
 
-	return nil
+// GetContainerResources returns the resource requests and limits of containerName in the live spec of the first
+// app pod, such as the app container or DaprSideCarName. A container without resources yields empty requirements.
+func (m *AppManager) GetContainerResources(containerName string) (apiv1.ResourceRequirements, error) {
+	podList, err := m.client.Pods(m.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return apiv1.ResourceRequirements{}, err
+	}
+
+	if len(podList.Items) == 0 {
+		return apiv1.ResourceRequirements{}, fmt.Errorf("no pods found for %s", m.app.AppName)
+	}
+
+	pod := podList.Items[0]
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return container.Resources, nil
+		}
+	}
+
+	return apiv1.ResourceRequirements{}, fmt.Errorf("container %s not found in pod %s", containerName, pod.Name)
+}
+
+// PodResourceUsage holds the CPU and memory usage of a container in an app pod
+type PodResourceUsage struct {
+	PodName       string
+	ContainerName string
+	CPUm          int64
+	MemoryMb      float64
 }
 
 // GetCPUAndMemory returns the Cpu and Memory usage for the dapr app or sidecar
 func (m *AppManager) GetCPUAndMemory(sidecar bool) (int64, float64, error) {
-	pods, err := m.GetHostDetails()
+	usages, err := m.GetResourceUsage(sidecar)
 	if err != nil {
 		return -1, -1, err
 	}
 
 	var maxCPU int64 = -1
 	var maxMemory float64 = -1
+	for _, usage := range usages {
+		if usage.CPUm > maxCPU {
+			maxCPU = usage.CPUm
+		}
+
+		if usage.MemoryMb > maxMemory {
+			maxMemory = usage.MemoryMb
+		}
+	}
+	if (maxCPU < 0) || (maxMemory < 0) {
+		return -1, -1, fmt.Errorf("container (sidecar=%v) not found in pods for app %s in namespace %s", sidecar, m.app.AppName, m.namespace)
+	}
+
+	return maxCPU, maxMemory, nil
+}
+
+// GetResourceUsage returns the Cpu and Memory usage of the dapr app or sidecar container in each pod.
+// ExtraContainers are neither.
+func (m *AppManager) GetResourceUsage(sidecar bool) ([]PodResourceUsage, error) {
+	if sidecar && !m.app.DaprEnabled {
+		return nil, fmt.Errorf("dapr is not enabled for this app")
+	}
+
+	usages, err := m.GetAllResourceUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	containerName := m.app.AppName
+	if sidecar {
+		containerName = DaprSideCarName
+	}
+
+	result := make([]PodResourceUsage, 0, len(usages))
+	for _, usage := range usages {
+		if usage.ContainerName == containerName {
+			result = append(result, usage)
+		}
+	}
+
+	return result, nil
+}
+
+// GetAllResourceUsage returns the Cpu and Memory usage of every container, app and sidecar, in each pod
+func (m *AppManager) GetAllResourceUsage() ([]PodResourceUsage, error) {
+	pods, err := m.GetHostDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []PodResourceUsage{}
 	for _, pod := range pods {
-		podName := pod.Name
-		metrics, err := m.client.MetricsClient.MetricsV1beta1().PodMetricses(m.namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+		usage, err := m.podResourceUsage(context.TODO(), pod.Name)
 		if err != nil {
-			return -1, -1, err
+			return nil, err
 		}
+		result = append(result, usage...)
+	}
+
+	return result, nil
+}
 
-		for _, c := range metrics.Containers {
-			isSidecar := c.Name == DaprSideCarName
-			if isSidecar == sidecar {
-				mi, _ := c.Usage.Memory().AsInt64()
-				mb := float64((mi / 1024)) * 0.001024
+// podResourceUsage returns the Cpu and Memory usage of every container in pod podName
+func (m *AppManager) podResourceUsage(ctx context.Context, podName string) ([]PodResourceUsage, error) {
+	metrics, err := m.client.MetricsClient.MetricsV1beta1().PodMetricses(m.namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-				cpu := c.Usage.Cpu().ScaledValue(resource.Milli)
+	result := make([]PodResourceUsage, 0, len(metrics.Containers))
+	for _, c := range metrics.Containers {
+		mi, _ := c.Usage.Memory().AsInt64()
+		mb := float64((mi / 1024)) * 0.001024
 
-				if cpu > maxCPU {
-					maxCPU = cpu
-				}
+		cpu := c.Usage.Cpu().ScaledValue(resource.Milli)
 
-				if mb > maxMemory {
-					maxMemory = mb
-				}
-			}
+		result = append(result, PodResourceUsage{
+			PodName:       podName,
+			ContainerName: c.Name,
+			CPUm:          cpu,
+			MemoryMb:      mb,
+		})
+	}
+
+	return result, nil
+}
+
+// ResourceSample is the Cpu and Memory usage of every container of the app pods at a point in time
+type ResourceSample struct {
+	Time  time.Time
+	Usage []PodResourceUsage
+}
+
+// SampleResourceUsage samples the Cpu and Memory usage of the app pods every interval for duration, e.g. to compute
+// percentiles or detect leaks in performance tests. Pods which metrics-server hasn't scraped yet are left out of a
+// sample, and samples without any usage are dropped. The samples taken so far are returned if ctx is done early.
+func (m *AppManager) SampleResourceUsage(ctx context.Context, interval, duration time.Duration) ([]ResourceSample, error) {
+	sampleCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	samples := []ResourceSample{}
+	for {
+		usage, err := m.sampleResourceUsage(sampleCtx)
+		if err != nil && sampleCtx.Err() == nil {
+			return samples, err
+		}
+		if len(usage) > 0 {
+			samples = append(samples, ResourceSample{Time: time.Now(), Usage: usage})
+		}
+
+		select {
+		case <-sampleCtx.Done():
+			// Reaching duration is not an error
+			return samples, ctx.Err()
+		case <-ticker.C:
 		}
 	}
-	if (maxCPU < 0) || (maxMemory < 0) {
-		return -1, -1, fmt.Errorf("container (sidecar=%v) not found in pods for app %s in namespace %s", sidecar, m.app.AppName, m.namespace)
+}
+
+// sampleResourceUsage returns the Cpu and Memory usage of the app pods, leaving out pods without metrics
+func (m *AppManager) sampleResourceUsage(ctx context.Context) ([]PodResourceUsage, error) {
+	podList, err := m.client.Pods(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: m.appLabelSelector(),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return maxCPU, maxMemory, nil
+	result := []PodResourceUsage{}
+	for _, pod := range podList.Items {
+		usage, err := m.podResourceUsage(ctx, pod.Name)
+		if errors.IsNotFound(err) {
+			// metrics-server lags behind new pods
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, usage...)
+	}
+
+	return result, nil
 }
 
 // GetTotalRestarts returns the total number of restarts for the app or sidecar
 func (m *AppManager) GetTotalRestarts() (int, error) {
-	if !m.app.DaprEnabled {
-		return 0, fmt.Errorf("dapr is not enabled for this app")
+	restarts, err := m.GetRestartsByContainer()
+	if err != nil {
+		return 0, err
+	}
+
+	restartCount := 0
+	for _, count := range restarts {
+		restartCount += count
+	}
+
+	return restartCount, nil
+}
+
+// GetRestartsByContainer returns the number of restarts by container name, summed over all app pods
+func (m *AppManager) GetRestartsByContainer() (map[string]int, error) {
+	restartsByPod, err := m.GetRestartsByPod()
+	if err != nil {
+		return nil, err
+	}
+
+	restarts := map[string]int{}
+	for _, podRestarts := range restartsByPod {
+		for container, count := range podRestarts {
+			restarts[container] += count
+		}
 	}
 
+	return restarts, nil
+}
+
+// GetRestartsByPod returns the number of restarts by pod name and container name
+func (m *AppManager) GetRestartsByPod() (map[string]map[string]int, error) {
 	podClient := m.client.Pods(m.namespace)
 
 	// Filter only 'testapp=appName' labeled Pods
 	podList, err := podClient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", TestAppLabelKey, m.app.AppName),
+		LabelSelector: m.appLabelSelector(),
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	restartCount := 0
+	restarts := map[string]map[string]int{}
 	for _, pod := range podList.Items {
 		pod, err := podClient.Get(context.TODO(), pod.GetName(), metav1.GetOptions{})
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
+		podRestarts := map[string]int{}
 		for _, containerStatus := range pod.Status.ContainerStatuses {
-			restartCount += int(containerStatus.RestartCount)
+			podRestarts[containerStatus.Name] = int(containerStatus.RestartCount)
 		}
+		restarts[pod.GetName()] = podRestarts
 	}
 
-	return restartCount, nil
+	return restarts, nil
+}
+
+// WaitStableNoRestarts samples the restarts of the app pods for window and returns an error naming the
+// restarted containers as soon as any restart count increases. It returns nil once window has elapsed.
+func (m *AppManager) WaitStableNoRestarts(ctx context.Context, window time.Duration) error {
+	baseline, err := m.GetRestartsByPod()
+	if err != nil {
+		return err
+	}
+
+	interval, _ := m.pollConfig()
+	waitErr := WaitUntil(ctx, func() (bool, error) {
+		restarts, err := m.GetRestartsByPod()
+		if err != nil {
+			return false, err
+		}
+		if restarted := restartedContainers(baseline, restarts); len(restarted) > 0 {
+			return false, fmt.Errorf("%s restarted within %s: %s", m.app.AppName, window, strings.Join(restarted, ", "))
+		}
+		return false, nil
+	}, interval, window)
+
+	if waitErr == wait.ErrWaitTimeout && ctx.Err() == nil {
+		// The whole window passed without restarts
+		return nil
+	}
+	if waitErr == wait.ErrWaitTimeout {
+		return ctx.Err()
+	}
+
+	return waitErr
+}
+
+// WaitForRestarts waits until the app containers restarted at least minRestarts more times in total than when it
+// was called, the poll timeout elapses or ctx is done. It returns the restarted containers.
+func (m *AppManager) WaitForRestarts(ctx context.Context, minRestarts int) ([]string, error) {
+	baseline, err := m.GetRestartsByPod()
+	if err != nil {
+		return nil, err
+	}
+
+	var restarted []string
+	waitErr := m.waitUntil(ctx, func() (bool, error) {
+		restarts, err := m.GetRestartsByPod()
+		if err != nil {
+			return false, err
+		}
+		restarted = restartedContainers(baseline, restarts)
+
+		increase := 0
+		for pod, containers := range restarts {
+			for container, count := range containers {
+				if previous := baseline[pod][container]; count > previous {
+					increase += count - previous
+				}
+			}
+		}
+		return increase >= minRestarts, nil
+	})
+
+	if waitErr != nil {
+		return restarted, fmt.Errorf("%s did not restart %d times, restarted: [%s]: %s", m.app.AppName, minRestarts, strings.Join(restarted, ", "), waitErr)
+	}
+
+	return restarted, nil
+}
+
+// restartedContainers describes the containers whose restart count increased from before to after
+func restartedContainers(before, after map[string]map[string]int) []string {
+	restarted := []string{}
+	for pod, containers := range after {
+		for container, count := range containers {
+			if previous := before[pod][container]; count > previous {
+				restarted = append(restarted, fmt.Sprintf("container %s of pod %s (%d -> %d)", container, pod, previous, count))
+			}
+		}
+	}
+	sort.Strings(restarted)
+
+	return restarted
 }
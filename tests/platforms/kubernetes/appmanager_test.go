@@ -6,22 +6,48 @@
 package kubernetes
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	configurationv1alpha1 "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
+	daprfake "github.com/dapr/dapr/pkg/client/clientset/versioned/fake"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
 )
 
 const (
@@ -78,6 +104,128 @@ func TestDeployApp(t *testing.T) {
 	assert.Equal(t, "dapriotest/helloworld", deployment.Spec.Template.Spec.Containers[0].Image)
 }
 
+func TestDeployAppRetry(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		client := newFakeKubeClient()
+		createCalled := 0
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			createVerb,
+			"deployments",
+			func(action core.Action) (bool, runtime.Object, error) {
+				createCalled++
+				if createCalled < 3 {
+					return true, nil, errors.NewInternalError(fmt.Errorf("etcd leader changed"))
+				}
+				return true, action.(core.CreateAction).GetObject(), nil
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp).WithCreateRetry(3, time.Millisecond)
+		d, err := appManager.Deploy()
+		assert.NoError(t, err)
+		assert.NotNil(t, d)
+		assert.Equal(t, 3, createCalled)
+	})
+
+	t.Run("retries run out", func(t *testing.T) {
+		client := newFakeKubeClient()
+		createCalled := 0
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			createVerb,
+			"deployments",
+			func(action core.Action) (bool, runtime.Object, error) {
+				createCalled++
+				return true, nil, errors.NewTooManyRequests("slow down", 0)
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp).WithCreateRetry(2, time.Millisecond)
+		_, err := appManager.Deploy()
+		assert.True(t, errors.IsTooManyRequests(err))
+		assert.Equal(t, 3, createCalled)
+	})
+
+	t.Run("already exists fails immediately", func(t *testing.T) {
+		client := newFakeKubeClient()
+		createCalled := 0
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			createVerb,
+			"deployments",
+			func(action core.Action) (bool, runtime.Object, error) {
+				createCalled++
+				return true, nil, errors.NewAlreadyExists(schema.GroupResource{Resource: "deployments"}, testApp.AppName)
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp).WithCreateRetry(3, time.Millisecond)
+		_, err := appManager.Deploy()
+		assert.True(t, errors.IsAlreadyExists(err))
+		assert.Equal(t, 1, createCalled)
+	})
+}
+
+func TestDeployStatefulSet(t *testing.T) {
+	client := newDefaultFakeClient()
+	testApp := testAppDescription()
+	testApp.WorkloadType = WorkloadTypeStatefulSet
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	// act
+	d, err := appManager.Deploy()
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+
+	// assert
+	statefulSet, err := client.StatefulSets(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, testApp.AppName, statefulSet.Spec.ServiceName)
+	assert.Equal(t, "true", statefulSet.Spec.Template.ObjectMeta.Annotations["dapr.io/enabled"])
+
+	_, err = client.Deployments(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// act
+	err = appManager.DisposeWithContext(context.Background(), false)
+	assert.NoError(t, err)
+
+	// assert
+	_, err = client.StatefulSets(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestWaitUntilStatefulSetState(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.WorkloadType = WorkloadTypeStatefulSet
+	testApp.Replicas = 2
+
+	statefulSet := buildStatefulSetObject(testNamespace, testApp)
+	statefulSet.Status.ReadyReplicas = 2
+	statefulSet.Status.CurrentRevision = "testapp-1"
+	statefulSet.Status.UpdateRevision = "testapp-2"
+
+	client := newFakeKubeClient()
+	getVerbCalled := 0
+	client.ClientSet.(*fake.Clientset).AddReactor(
+		getVerb,
+		"statefulsets",
+		func(action core.Action) (bool, runtime.Object, error) {
+			getVerbCalled++
+			// the rolling update finishes on the third poll
+			if getVerbCalled == 3 {
+				statefulSet.Status.CurrentRevision = statefulSet.Status.UpdateRevision
+			}
+			return true, statefulSet.DeepCopy(), nil
+		})
+
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+	// act
+	err := appManager.WaitUntilWorkloadReady(context.Background())
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3, getVerbCalled)
+}
+
 func TestWaitUntilDeploymentState(t *testing.T) {
 	testApp := testAppDescription()
 	var createdDeploymentObj *appsv1.Deployment
@@ -183,9 +331,258 @@ func TestWaitUntilDeploymentState(t *testing.T) {
 	})
 }
 
+func TestWaitUntilDeploymentStateWithContext(t *testing.T) {
+	testApp := testAppDescription()
+	client := newFakeKubeClient()
+
+	// Set up reactor to always return a deployment which is not ready
+	client.ClientSet.(*fake.Clientset).AddReactor(
+		getVerb,
+		"deployments",
+		func(action core.Action) (bool, runtime.Object, error) {
+			return true, &appsv1.Deployment{}, nil
+		})
+
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	d, err := appManager.WaitUntilDeploymentStateWithContext(ctx, appManager.IsDeploymentDone)
+
+	assert.Error(t, err)
+	assert.Nil(t, d)
+	assert.Less(t, int64(time.Since(start)), int64(PollTimeout))
+}
+
+func TestPollConfig(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("zero values fall back to defaults", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp).WithPollConfig(0, 0)
+		interval, timeout := appManager.pollConfig()
+		assert.Equal(t, PollInterval, interval)
+		assert.Equal(t, PollTimeout, timeout)
+	})
+
+	t.Run("custom values", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp).WithPollConfig(10*time.Millisecond, 100*time.Millisecond)
+		interval, timeout := appManager.pollConfig()
+		assert.Equal(t, 10*time.Millisecond, interval)
+		assert.Equal(t, 100*time.Millisecond, timeout)
+	})
+
+	t.Run("timeout is used by WaitUntilDeploymentState", func(t *testing.T) {
+		client := newFakeKubeClient()
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			getVerb,
+			"deployments",
+			func(action core.Action) (bool, runtime.Object, error) {
+				return true, &appsv1.Deployment{}, nil
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 100*time.Millisecond)
+
+		start := time.Now()
+		_, err := appManager.WaitUntilDeploymentState(appManager.IsDeploymentDone)
+		assert.Error(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	})
+}
+
+func TestWaitUntilDeploymentStateWarningEvents(t *testing.T) {
+	testApp := testAppDescription()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+	}
+	newEvent := func(name, podName, reason string) *apiv1.Event {
+		return &apiv1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+			},
+			InvolvedObject: apiv1.ObjectReference{
+				Kind: "Pod",
+				Name: podName,
+			},
+			Type:    apiv1.EventTypeWarning,
+			Reason:  reason,
+			Message: reason + " message",
+		}
+	}
+
+	fakeClient := fake.NewSimpleClientset(
+		pod,
+		newEvent("event1", "testapp-pod", "ImagePullBackOff"),
+		newEvent("event2", "otherapp-pod", "FailedScheduling"),
+	)
+	fakeClient.PrependReactor(
+		getVerb,
+		"deployments",
+		func(action core.Action) (bool, runtime.Object, error) {
+			return true, &appsv1.Deployment{}, nil
+		})
+
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 100*time.Millisecond)
+
+	_, err := appManager.WaitUntilDeploymentState(appManager.IsDeploymentDone)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ImagePullBackOff")
+	assert.NotContains(t, err.Error(), "FailedScheduling")
+
+	timeoutErr, ok := err.(*DeploymentTimeoutError)
+	assert.True(t, ok)
+	assert.Equal(t, testApp.AppName, timeoutErr.AppName)
+	assert.NotNil(t, timeoutErr.LastDeployment)
+	assert.Greater(t, int64(timeoutErr.Elapsed), int64(0))
+	assert.Equal(t, wait.ErrWaitTimeout, timeoutErr.Unwrap())
+}
+
+func TestWaitUntilRolloutComplete(t *testing.T) {
+	testApp := testAppDescription()
+	newDeployment := func(updated int32) *appsv1.Deployment {
+		deployment := buildDeploymentObject(testNamespace, testApp)
+		deployment.Annotations = map[string]string{deploymentRevisionAnnotation: "2"}
+		deployment.Status = appsv1.DeploymentStatus{
+			UpdatedReplicas:   updated,
+			Replicas:          1,
+			AvailableReplicas: 1,
+		}
+		return deployment
+	}
+	newReplicaSet := func(hash, revision string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        testApp.AppName + "-" + hash,
+				Namespace:   testNamespace,
+				Annotations: map[string]string{deploymentRevisionAnnotation: revision},
+				Labels: map[string]string{
+					TestAppLabelKey:                        testApp.AppName,
+					appsv1.DefaultDeploymentUniqueLabelKey: hash,
+				},
+			},
+		}
+	}
+	newPod := func(name, hash string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey:                        testApp.AppName,
+					appsv1.DefaultDeploymentUniqueLabelKey: hash,
+				},
+			},
+		}
+	}
+
+	t.Run("rollout complete", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newDeployment(1),
+			newReplicaSet("new", "2"),
+			newReplicaSet("old", "1"),
+			newPod("testapp-new-pod", "new"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.WaitUntilRolloutComplete()
+		assert.NoError(t, err)
+	})
+
+	t.Run("old pod remains", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newDeployment(1),
+			newReplicaSet("new", "2"),
+			newReplicaSet("old", "1"),
+			newPod("testapp-new-pod", "new"),
+			newPod("testapp-old-pod", "old"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+		err := appManager.WaitUntilRolloutComplete()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "pod testapp-old-pod of ReplicaSet testapp-old still exists")
+	})
+
+	t.Run("replicas not updated", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newDeployment(0),
+			newReplicaSet("new", "2"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+		err := appManager.WaitUntilRolloutComplete()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "0 updated")
+	})
+}
+
+func TestGetEvents(t *testing.T) {
+	testApp := testAppDescription()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+	}
+	newEvent := func(name, kind, objName, reason string, age time.Duration) *apiv1.Event {
+		return &apiv1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+			},
+			InvolvedObject: apiv1.ObjectReference{
+				Kind: kind,
+				Name: objName,
+			},
+			Reason:        reason,
+			LastTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}
+	}
+
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		pod,
+		newEvent("event1", "Pod", "testapp-pod", "Started", time.Minute),
+		newEvent("event2", "Deployment", testApp.AppName, "ScalingReplicaSet", time.Hour),
+		newEvent("event3", "Pod", "otherapp-pod", "Evicted", time.Second),
+	)}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 100*time.Millisecond)
+
+	t.Run("events of app pods and deployment", func(t *testing.T) {
+		events, err := appManager.GetEvents()
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+		assert.Equal(t, "ScalingReplicaSet", events[0].Reason)
+		assert.Equal(t, "Started", events[1].Reason)
+	})
+
+	t.Run("wait for event", func(t *testing.T) {
+		event, err := appManager.WaitForEvent(context.Background(), "Started")
+		assert.NoError(t, err)
+		assert.Equal(t, "event1", event.Name)
+	})
+
+	t.Run("wait for event of other pod times out", func(t *testing.T) {
+		_, err := appManager.WaitForEvent(context.Background(), "Evicted")
+		assert.Error(t, err)
+	})
+}
+
 func TestScaleDeploymentReplica(t *testing.T) {
 	testApp := testAppDescription()
 	client := newFakeKubeClient()
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+	deploymentGetCalled := 0
 	// Set up reactor to fake verb
 	client.ClientSet.(*fake.Clientset).AddReactor(
 		"*",
@@ -194,6 +591,18 @@ func TestScaleDeploymentReplica(t *testing.T) {
 			ns := action.GetNamespace()
 			assert.Equal(t, testNamespace, ns)
 			subRs := action.GetSubresource()
+
+			// the deployment itself is read while waiting for the new replicas
+			if subRs == "" && action.GetVerb() == getVerb {
+				deploymentGetCalled++
+				replicas := appManager.App().Replicas
+				return true, &appsv1.Deployment{
+					Status: appsv1.DeploymentStatus{
+						ReadyReplicas:     replicas,
+						AvailableReplicas: replicas,
+					},
+				}, nil
+			}
 			assert.Equal(t, "scale", subRs)
 
 			var scaleObj *autoscalingv1.Scale
@@ -217,8 +626,6 @@ func TestScaleDeploymentReplica(t *testing.T) {
 			return true, scaleObj, nil
 		})
 
-	appManager := NewAppManager(client, testNamespace, testApp)
-
 	t.Run("lower bound check", func(t *testing.T) {
 		err := appManager.ScaleDeploymentReplica(-1)
 		assert.Error(t, err)
@@ -235,92 +642,526 @@ func TestScaleDeploymentReplica(t *testing.T) {
 	})
 
 	t.Run("new replicas", func(t *testing.T) {
+		deploymentGetCalled = 0
 		err := appManager.ScaleDeploymentReplica(3)
 		assert.NoError(t, err)
+		assert.Equal(t, 1, deploymentGetCalled)
 	})
-}
-
-func TestValidiateSideCar(t *testing.T) {
-	testApp := testAppDescription()
 
-	objMeta := metav1.ObjectMeta{
-		Name:      testApp.AppName,
-		Namespace: testNamespace,
-		Labels: map[string]string{
-			TestAppLabelKey: testApp.AppName,
-		},
-	}
+	t.Run("upper bound error names the limit", func(t *testing.T) {
+		err := appManager.ScaleDeploymentReplica(maxReplicas + 1)
+		assert.Contains(t, err.Error(), fmt.Sprintf("between 0 and %d", maxReplicas))
+	})
 
-	t.Run("Sidecar is injected", func(t *testing.T) {
-		client := newFakeKubeClient()
-		// Set up reactor to fake verb
-		client.ClientSet.(*fake.Clientset).AddReactor(
-			"list",
-			"pods",
-			func(action core.Action) (bool, runtime.Object, error) {
-				ns := action.GetNamespace()
-				assert.Equal(t, testNamespace, ns)
+	t.Run("configured max replicas", func(t *testing.T) {
+		app := testAppDescription()
+		app.MaxReplicas = 50
+		largeAppManager := NewAppManager(client, testNamespace, app)
 
-				singlePod := apiv1.Pod{
-					ObjectMeta: objMeta,
-					Spec: apiv1.PodSpec{
-						Containers: []apiv1.Container{
-							{
-								Name:  "daprd",
-								Image: "daprio/daprd:latest",
-							},
-							{
-								Name:  testApp.AppName,
-								Image: fmt.Sprintf("%s/%s", testApp.RegistryName, testApp.ImageName),
-							},
-						},
-					},
-				}
+		err := largeAppManager.ScaleDeploymentReplicaNoWait(30)
+		assert.NoError(t, err)
 
-				podList := &apiv1.PodList{
-					Items: []apiv1.Pod{singlePod},
-				}
+		err = largeAppManager.ScaleDeploymentReplicaNoWait(51)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "between 0 and 50")
 
-				return true, podList, nil
-			})
+		err = largeAppManager.ScaleDeploymentReplicaNoWait(-1)
+		assert.Error(t, err)
+	})
 
-		appManager := NewAppManager(client, testNamespace, testApp)
-		found, err := appManager.ValidiateSideCar()
+	t.Run("concurrent scale and read", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := int32(1); i <= 5; i++ {
+				assert.NoError(t, appManager.ScaleDeploymentReplicaNoWait(i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				_ = appManager.App().Replicas
+				_, _ = appManager.GetHostDetails()
+			}
+		}()
+		wg.Wait()
+	})
 
+	t.Run("no wait", func(t *testing.T) {
+		deploymentGetCalled = 0
+		err := appManager.ScaleDeploymentReplicaNoWait(2)
 		assert.NoError(t, err)
-		assert.True(t, found)
+		assert.Equal(t, 0, deploymentGetCalled)
+		assert.Equal(t, int32(2), appManager.App().Replicas)
 	})
+}
 
-	t.Run("Sidecar is not injected", func(t *testing.T) {
-		client := newFakeKubeClient()
-		// Set up reactor to fake verb
-		client.ClientSet.(*fake.Clientset).AddReactor(
-			"list",
-			"pods",
-			func(action core.Action) (bool, runtime.Object, error) {
-				ns := action.GetNamespace()
-				assert.Equal(t, testNamespace, ns)
+func TestRolloutRestart(t *testing.T) {
+	testApp := testAppDescription()
+	deployment := buildDeploymentObject(testNamespace, testApp)
+	deployment.Status = appsv1.DeploymentStatus{
+		Replicas:          testApp.Replicas,
+		UpdatedReplicas:   testApp.Replicas,
+		ReadyReplicas:     testApp.Replicas,
+		AvailableReplicas: testApp.Replicas,
+	}
+	client := &KubeClient{
+		ClientSet: fake.NewSimpleClientset(deployment),
+	}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
 
-				singlePod := apiv1.Pod{
-					ObjectMeta: objMeta,
-					Spec: apiv1.PodSpec{
-						Containers: []apiv1.Container{
-							{
-								Name:  testApp.AppName,
-								Image: fmt.Sprintf("%s/%s", testApp.RegistryName, testApp.ImageName),
-							},
-						},
-					},
-				}
+	// act
+	err := appManager.RolloutRestart()
 
-				podList := &apiv1.PodList{
-					Items: []apiv1.Pod{singlePod},
-				}
+	// assert
+	assert.NoError(t, err)
+	d, err := client.Deployments(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	restartedAt := d.Spec.Template.Annotations[restartedAtAnnotation]
+	assert.NotEmpty(t, restartedAt)
+	_, err = time.Parse(time.RFC3339, restartedAt)
+	assert.NoError(t, err)
+	// the existing pod template annotations are kept
+	assert.Equal(t, "true", d.Spec.Template.Annotations["dapr.io/enabled"])
+}
 
-				return true, podList, nil
-			})
+func TestDeployAndWait(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(containers ...string) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+		}
+		for _, container := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{Name: container})
+		}
+		return pod
+	}
+	readyDeployment := func(fakeClient *fake.Clientset) {
+		fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+			return true, &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: testApp.AppName},
+				Status: appsv1.DeploymentStatus{
+					ReadyReplicas:     1,
+					AvailableReplicas: 1,
+				},
+			}, nil
+		})
+	}
 
-		appManager := NewAppManager(client, testNamespace, testApp)
+	t.Run("sidecar is injected", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(newPod(testApp.AppName, DaprSideCarName))
+		readyDeployment(fakeClient)
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		deployment, err := appManager.DeployAndWait(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, testApp.AppName, deployment.Name)
+	})
+
+	t.Run("sidecar is missing", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(newPod(testApp.AppName))
+		readyDeployment(fakeClient)
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		_, err := appManager.DeployAndWait(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestTimings(t *testing.T) {
+	testApp := testAppDescription()
+	fakeClient := fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: testApp.AppName}, {Name: DaprSideCarName}},
+		},
+	})
+	fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		return true, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: testApp.AppName},
+			Status: appsv1.DeploymentStatus{
+				ReadyReplicas:     1,
+				AvailableReplicas: 1,
+			},
+		}, nil
+	})
+
+	var steps []string
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).
+		WithPollConfig(time.Millisecond, time.Second).
+		WithTimingCollector(func(step string, duration time.Duration) {
+			steps = append(steps, step)
+		})
+
+	_, err := appManager.DeployAndWait(context.Background())
+	assert.NoError(t, err)
+	err = appManager.DisposeWithoutLogs(false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{TimingDeployCreate, TimingDeployReady, TimingDisposeDelete}, steps)
+	timings := appManager.Timings()
+	assert.Greater(t, int64(timings.DeployCreate), int64(0))
+	assert.Greater(t, int64(timings.DeployReady), int64(0))
+	assert.Greater(t, int64(timings.DisposeDelete), int64(0))
+	assert.Equal(t, time.Duration(0), timings.Init)
+	assert.Equal(t, time.Duration(0), timings.DisposeWait)
+}
+
+func TestDeployVariant(t *testing.T) {
+	testApp := testAppDescription()
+	canaryName := testApp.AppName + "-canary"
+	fakeClient := fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-canary-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: canaryName,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: canaryName}, {Name: DaprSideCarName}},
+		},
+	})
+	deploymentsResource := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		obj, err := fakeClient.Tracker().Get(deploymentsResource, testNamespace, action.(core.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		deployment := obj.(*appsv1.Deployment).DeepCopy()
+		deployment.Status.ReadyReplicas = *deployment.Spec.Replicas
+		deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+		return true, deployment, nil
+	})
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+	t.Run("deploy variant", func(t *testing.T) {
+		canaryApp := testApp
+		canaryApp.ImageName = "helloworld-v2"
+		variant, err := appManager.DeployVariant("canary", canaryApp)
+		assert.NoError(t, err)
+		assert.Equal(t, canaryName, variant.Name())
+		assert.Same(t, variant, appManager.Variant("canary"))
+		assert.Nil(t, appManager.Variant("blue"))
+
+		deployment, err := fakeClient.AppsV1().Deployments(testNamespace).Get(context.Background(), canaryName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, canaryName, deployment.Spec.Template.Labels[TestAppLabelKey])
+		assert.Equal(t, "dapriotest/helloworld-v2", deployment.Spec.Template.Spec.Containers[0].Image)
+
+		_, err = fakeClient.CoreV1().Services(testNamespace).Get(context.Background(), canaryName, metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid suffix", func(t *testing.T) {
+		_, err := appManager.DeployVariant("", testApp)
+		assert.Error(t, err)
+		_, err = appManager.DeployVariant("canary", testApp)
+		assert.Error(t, err)
+	})
+
+	t.Run("disposed with the app", func(t *testing.T) {
+		err := appManager.DisposeWithoutLogs(true)
+		assert.NoError(t, err)
+		assert.Nil(t, appManager.Variant("canary"))
+
+		_, err = fakeClient.AppsV1().Deployments(testNamespace).Get(context.Background(), canaryName, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestReset(t *testing.T) {
+	testApp := testAppDescription()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: testApp.AppName}, {Name: DaprSideCarName}},
+		},
+	}
+	fakeClient := fake.NewSimpleClientset(
+		pod,
+		buildDeploymentObject(testNamespace, testApp),
+		buildServiceObject(testNamespace, testApp),
+	)
+	recreated := false
+	fakeClient.PrependReactor("create", "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		recreated = true
+		return false, nil, nil
+	})
+	fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		if !recreated {
+			return false, nil, nil
+		}
+		return true, &appsv1.Deployment{
+			Status: appsv1.DeploymentStatus{
+				ReadyReplicas:     1,
+				AvailableReplicas: 1,
+			},
+		}, nil
+	})
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+	err := appManager.Reset()
+	assert.NoError(t, err)
+	assert.True(t, recreated)
+	assert.NotNil(t, appManager.portForwarder())
+
+	_, err = fakeClient.CoreV1().Services(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestTCPForwards(t *testing.T) {
+	forwarder := NewPodPortForwarder(newDefaultFakeClient(), testNamespace)
+	forwarder.sessions["testapp-pod"] = []*portForwardSession{
+		{localPorts: []int{40000}, podPorts: []int{3000}, stopChannel: make(chan struct{})},
+		{localPorts: []int{40001}, podPorts: []int{45000}, stopChannel: make(chan struct{}), udpRelay: &net.UDPConn{}},
+	}
+
+	forwards := forwarder.tcpForwards()
+	assert.Equal(t, []portForward{{podName: "testapp-pod", localPorts: []int{40000}, podPorts: []int{3000}}}, forwards)
+}
+
+func TestInvokeWithRetry(t *testing.T) {
+	t.Run("retries 5xx responses", func(t *testing.T) {
+		var calls int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "ping", string(body))
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("pong"))
+		}))
+		defer server.Close()
+
+		body, status, err := invokeWithRetry(context.Background(), server.URL, http.MethodPost, []byte("ping"), 5, time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "pong", string(body))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("returns the last 5xx response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("failed"))
+		}))
+		defer server.Close()
+
+		body, status, err := invokeWithRetry(context.Background(), server.URL, http.MethodGet, nil, 2, time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.Equal(t, "failed", string(body))
+	})
+
+	t.Run("does not retry 4xx responses", func(t *testing.T) {
+		var calls int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		_, status, err := invokeWithRetry(context.Background(), server.URL, http.MethodGet, nil, 5, time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		url := fmt.Sprintf("http://%s", listener.Addr())
+		listener.Close()
+
+		_, _, err = invokeWithRetry(context.Background(), url, http.MethodGet, nil, 2, time.Millisecond)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "after 2 retries")
+	})
+}
+
+func TestFetchSidecarMetadata(t *testing.T) {
+	newServer := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1.0/metadata", r.URL.Path)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+	}
+
+	t.Run("runtime version", func(t *testing.T) {
+		server := newServer(http.StatusOK, `{"id":"testapp","runtimeVersion":"1.12.0","extended":{"daprRuntimeVersion":"1.11.0"}}`)
+		defer server.Close()
+
+		metadata, err := fetchSidecarMetadata(context.Background(), server.URL+"/v1.0/metadata")
+		assert.NoError(t, err)
+		assert.Equal(t, "testapp", metadata.ID)
+		assert.Equal(t, "1.12.0", metadata.RuntimeVersion)
+	})
+
+	t.Run("extended runtime version", func(t *testing.T) {
+		server := newServer(http.StatusOK, `{"id":"testapp","extended":{"daprRuntimeVersion":"1.0.0"}}`)
+		defer server.Close()
+
+		metadata, err := fetchSidecarMetadata(context.Background(), server.URL+"/v1.0/metadata")
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", metadata.Extended["daprRuntimeVersion"])
+	})
+
+	t.Run("components", func(t *testing.T) {
+		server := newServer(http.StatusOK, `{"id":"testapp","components":[{"name":"statestore","type":"state.redis","version":"v1"},{"name":"pubsub","type":"pubsub.redis","version":"v1"}]}`)
+		defer server.Close()
+
+		metadata, err := fetchSidecarMetadata(context.Background(), server.URL+"/v1.0/metadata")
+		assert.NoError(t, err)
+		assert.Equal(t, []ComponentInfo{
+			{Name: "statestore", Type: "state.redis", Version: "v1"},
+			{Name: "pubsub", Type: "pubsub.redis", Version: "v1"},
+		}, metadata.Components)
+	})
+
+	t.Run("metadata unavailable", func(t *testing.T) {
+		server := newServer(http.StatusNotFound, "")
+		defer server.Close()
+
+		_, err := fetchSidecarMetadata(context.Background(), server.URL+"/v1.0/metadata")
+		assert.Equal(t, ErrSidecarMetadataUnavailable, err)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		server := newServer(http.StatusOK, "not json")
+		defer server.Close()
+
+		_, err := fetchSidecarMetadata(context.Background(), server.URL+"/v1.0/metadata")
+		assert.Error(t, err)
+		assert.NotEqual(t, ErrSidecarMetadataUnavailable, err)
+	})
+}
+
+func TestRemapUsedLocalPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	usedPort := listener.Addr().(*net.TCPAddr).Port
+
+	freeListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	freePort := freeListener.Addr().(*net.TCPAddr).Port
+	freeListener.Close()
+
+	ports := []int{usedPort, freePort}
+	remapped, err := remapUsedLocalPorts("testapp-pod", ports, []int{3000, 3500})
+	assert.NoError(t, err)
+	assert.True(t, remapped)
+	assert.NotEqual(t, usedPort, ports[0])
+	assert.Equal(t, freePort, ports[1])
+	assert.False(t, anyLocalPortUsed(ports))
+	assert.True(t, anyLocalPortUsed([]int{usedPort}))
+}
+
+func TestValidiateSideCar(t *testing.T) {
+	testApp := testAppDescription()
+
+	objMeta := metav1.ObjectMeta{
+		Name:      testApp.AppName,
+		Namespace: testNamespace,
+		Labels: map[string]string{
+			TestAppLabelKey: testApp.AppName,
+		},
+	}
+
+	t.Run("Sidecar is injected", func(t *testing.T) {
+		client := newFakeKubeClient()
+		// Set up reactor to fake verb
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			"list",
+			"pods",
+			func(action core.Action) (bool, runtime.Object, error) {
+				ns := action.GetNamespace()
+				assert.Equal(t, testNamespace, ns)
+
+				singlePod := apiv1.Pod{
+					ObjectMeta: objMeta,
+					Spec: apiv1.PodSpec{
+						Containers: []apiv1.Container{
+							{
+								Name:  "daprd",
+								Image: "daprio/daprd:latest",
+							},
+							{
+								Name:  testApp.AppName,
+								Image: fmt.Sprintf("%s/%s", testApp.RegistryName, testApp.ImageName),
+							},
+						},
+					},
+				}
+
+				podList := &apiv1.PodList{
+					Items: []apiv1.Pod{singlePod},
+				}
+
+				return true, podList, nil
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp)
+		found, err := appManager.ValidiateSideCar()
+
+		assert.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("Sidecar is not injected", func(t *testing.T) {
+		client := newFakeKubeClient()
+		// Set up reactor to fake verb
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			"list",
+			"pods",
+			func(action core.Action) (bool, runtime.Object, error) {
+				ns := action.GetNamespace()
+				assert.Equal(t, testNamespace, ns)
+
+				singlePod := apiv1.Pod{
+					ObjectMeta: objMeta,
+					Spec: apiv1.PodSpec{
+						Containers: []apiv1.Container{
+							{
+								Name:  testApp.AppName,
+								Image: fmt.Sprintf("%s/%s", testApp.RegistryName, testApp.ImageName),
+							},
+						},
+					},
+				}
+
+				podList := &apiv1.PodList{
+					Items: []apiv1.Pod{singlePod},
+				}
+
+				return true, podList, nil
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp)
 		found, err := appManager.ValidiateSideCar()
 		assert.False(t, found)
 		assert.Error(t, err)
@@ -483,6 +1324,62 @@ func TestWaitUntilServiceStateAndGetExternalURL(t *testing.T) {
 	os.Setenv(MiniKubeIPEnvVar, oldMinikubeIP)
 }
 
+func TestAcquireExternalURLForPort(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.ExtraPorts = []int{9090}
+
+	// Set fake minikube node IP address
+	oldMinikubeIP := os.Getenv(MiniKubeIPEnvVar)
+	defer os.Setenv(MiniKubeIPEnvVar, oldMinikubeIP)
+
+	newClient := func(svc *apiv1.Service) *KubeClient {
+		client := newFakeKubeClient()
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			getVerb,
+			"services",
+			func(action core.Action) (bool, runtime.Object, error) {
+				return true, svc, nil
+			})
+		return client
+	}
+
+	t.Run("Kubernetes environment", func(t *testing.T) {
+		os.Setenv(MiniKubeIPEnvVar, "")
+
+		svc := buildServiceObject(testNamespace, testApp)
+		svc.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: "10.10.10.100"}}
+		appManager := NewAppManager(newClient(svc), testNamespace, testApp)
+
+		assert.Equal(t, "10.10.10.100:3000", appManager.AcquireExternalURLForPort(DefaultExternalPort))
+		assert.Equal(t, "10.10.10.100:9090", appManager.AcquireExternalURLForPort(9090))
+		assert.Equal(t, "", appManager.AcquireExternalURLForPort(8080))
+	})
+
+	t.Run("Minikube environment", func(t *testing.T) {
+		os.Setenv(MiniKubeIPEnvVar, "192.168.0.12")
+
+		svc := buildServiceObject(testNamespace, testApp)
+		svc.Spec.Ports[0].NodePort = 31000
+		svc.Spec.Ports[1].NodePort = 31001
+		appManager := NewAppManager(newClient(svc), testNamespace, testApp)
+
+		assert.Equal(t, "192.168.0.12:31001", appManager.AcquireExternalURLForPort(9090))
+	})
+
+	t.Run("Port name", func(t *testing.T) {
+		os.Setenv(MiniKubeIPEnvVar, "")
+
+		app := testApp
+		app.Ports = []AppPort{{Name: "http", ContainerPort: 3000}, {Name: "grpc", ContainerPort: 50051}}
+		svc := buildServiceObject(testNamespace, app)
+		svc.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: "10.10.10.100"}}
+		appManager := NewAppManager(newClient(svc), testNamespace, app)
+
+		assert.Equal(t, "10.10.10.100:50051", appManager.AcquireExternalURLForPortName("grpc"))
+		assert.Equal(t, "", appManager.AcquireExternalURLForPortName("metrics"))
+	})
+}
+
 func TestWaitUntilServiceStateDeleted(t *testing.T) {
 	// fake test values
 	testApp := testAppDescription()
@@ -510,37 +1407,127 @@ func TestWaitUntilServiceStateDeleted(t *testing.T) {
 	assert.Nil(t, svcObj)
 }
 
-func TestGetOrCreateNamespace(t *testing.T) {
-	// fake test values
+func TestWaitUntilServiceStateDiagnostics(t *testing.T) {
 	testApp := testAppDescription()
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		buildServiceObject(testNamespace, testApp),
+		&apiv1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "event1",
+				Namespace: testNamespace,
+			},
+			InvolvedObject: apiv1.ObjectReference{
+				Kind: "Service",
+				Name: testApp.AppName,
+			},
+			Reason:  "SyncLoadBalancerFailed",
+			Message: "quota exceeded",
+		},
+	)}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
 
-	t.Run("create namespace", func(t *testing.T) {
-		client := newFakeKubeClient()
-		var fakeNsObj *apiv1.Namespace
-		// Set up reactor to fake verb
-		client.ClientSet.(*fake.Clientset).AddReactor(
-			"*",
-			"namespaces",
-			func(action core.Action) (bool, runtime.Object, error) {
-				switch action.GetVerb() {
-				case createVerb:
-					// return the same namespace object
-					fakeNsObj = action.(core.CreateAction).GetObject().(*apiv1.Namespace)
-
-				case getVerb:
-					err := errors.NewNotFound(
-						schema.GroupResource{
-							Group:    "fakeGroup",
-							Resource: "fakeResource",
-						},
-						"namespaces")
+	_, err := appManager.WaitUntilServiceState(appManager.IsServiceIngressReady)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "load balancer ingress: []")
+	assert.Contains(t, err.Error(), "SyncLoadBalancerFailed: quota exceeded")
 
-					return true, nil, err
-				}
-				return true, fakeNsObj, nil
-			})
+	timeoutErr, ok := err.(*ServiceTimeoutError)
+	assert.True(t, ok)
+	assert.Equal(t, testApp.AppName, timeoutErr.AppName)
+	assert.NotNil(t, timeoutErr.LastService)
+	assert.Equal(t, wait.ErrWaitTimeout, timeoutErr.Unwrap())
+}
 
-		appManager := NewAppManager(client, testNamespace, testApp)
+func TestDeleteTestNamespaces(t *testing.T) {
+	newNamespace := func(name, runID string) *apiv1.Namespace {
+		ns := &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if runID != "" {
+			ns.Labels = map[string]string{
+				TestNamespaceLabelKey: "true",
+				TestRunIDLabelKey:     runID,
+			}
+		}
+		return ns
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		newNamespace("test-ns-1", "run-1"),
+		newNamespace("test-ns-2", "run-2"),
+		newNamespace("existing-ns", ""),
+	)}
+	namespaceNames := func() []string {
+		namespaceList, err := client.Namespaces().List(context.Background(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		var names []string
+		for _, ns := range namespaceList.Items {
+			names = append(names, ns.Name)
+		}
+		return names
+	}
+
+	err := DeleteTestNamespaces(client, "run-1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"test-ns-2", "existing-ns"}, namespaceNames())
+
+	err = DeleteTestNamespaces(client, "")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"existing-ns"}, namespaceNames())
+}
+
+func TestRequireExistingNamespace(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("missing namespace", func(t *testing.T) {
+		client := newDefaultFakeClient()
+		appManager := NewAppManager(client, testNamespace, testApp).WithRequireExistingNamespace()
+
+		err := appManager.Init()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "doesn't exist")
+
+		namespaces, err := client.Namespaces().List(context.TODO(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		assert.Empty(t, namespaces.Items)
+	})
+
+	t.Run("existing namespace", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(buildNamespaceObject(testNamespace))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		assert.NoError(t, appManager.requireNamespace(context.TODO()))
+	})
+}
+
+func TestGetOrCreateNamespace(t *testing.T) {
+	// fake test values
+	testApp := testAppDescription()
+
+	t.Run("create namespace", func(t *testing.T) {
+		client := newFakeKubeClient()
+		var fakeNsObj *apiv1.Namespace
+		// Set up reactor to fake verb
+		client.ClientSet.(*fake.Clientset).AddReactor(
+			"*",
+			"namespaces",
+			func(action core.Action) (bool, runtime.Object, error) {
+				switch action.GetVerb() {
+				case createVerb:
+					// return the same namespace object
+					fakeNsObj = action.(core.CreateAction).GetObject().(*apiv1.Namespace)
+
+				case getVerb:
+					err := errors.NewNotFound(
+						schema.GroupResource{
+							Group:    "fakeGroup",
+							Resource: "fakeResource",
+						},
+						"namespaces")
+
+					return true, nil, err
+				}
+				return true, fakeNsObj, nil
+			})
+
+		appManager := NewAppManager(client, testNamespace, testApp)
 		nsObj, err := appManager.GetOrCreateNamespace()
 		assert.NoError(t, err)
 		assert.Equal(t, testNamespace, nsObj.ObjectMeta.Name)
@@ -660,3 +1647,2883 @@ func TestDeleteService(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteJSONLLogs(t *testing.T) {
+	testSets := []struct {
+		tc            string
+		containerName string
+		logs          string
+		expected      []map[string]interface{}
+	}{
+		{
+			"JSON object line is annotated",
+			"testapp",
+			`{"level":"info","pod":"from-app"}`,
+			[]map[string]interface{}{
+				{"level": "info", "pod": "from-app"},
+			},
+		},
+		{
+			"non-JSON line is wrapped as raw",
+			"testapp",
+			"plain text line",
+			[]map[string]interface{}{
+				{"raw": "plain text line"},
+			},
+		},
+		{
+			"blank lines are skipped",
+			"testapp",
+			"first\n\n   \nsecond\n",
+			[]map[string]interface{}{
+				{"raw": "first"},
+				{"raw": "second"},
+			},
+		},
+		{
+			"JSON array and scalar lines are wrapped as raw",
+			"testapp",
+			"[1,2]\n42",
+			[]map[string]interface{}{
+				{"raw": "[1,2]"},
+				{"raw": "42"},
+			},
+		},
+		{
+			"daprd container is the sidecar source",
+			DaprSideCarName,
+			`{"msg":"dapr initialized"}`,
+			[]map[string]interface{}{
+				{"msg": "dapr initialized"},
+			},
+		},
+	}
+
+	for _, tt := range testSets {
+		t.Run(tt.tc, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeJSONLLogs(&out, strings.NewReader(tt.logs), "testapp-pod", tt.containerName)
+			assert.NoError(t, err)
+
+			expectedSource := "app"
+			if tt.containerName == DaprSideCarName {
+				expectedSource = "sidecar"
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			assert.Equal(t, len(tt.expected), len(lines))
+
+			for i, line := range lines {
+				record := map[string]interface{}{}
+				assert.NoError(t, json.Unmarshal([]byte(line), &record))
+				assert.Equal(t, map[string]interface{}{
+					"pod":       "testapp-pod",
+					"container": tt.containerName,
+					"source":    expectedSource,
+				}, record["_meta"])
+
+				delete(record, "_meta")
+				assert.Equal(t, tt.expected[i], record)
+			}
+		})
+	}
+
+	t.Run("long line does not abort the save", func(t *testing.T) {
+		longLine := strings.Repeat("a", maxLogLineSize+10)
+
+		var out bytes.Buffer
+		err := writeJSONLLogs(&out, strings.NewReader(longLine+"\nafter"), "testapp-pod", "testapp")
+		assert.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(t, 3, len(lines))
+		assert.Contains(t, lines[2], `"raw":"after"`)
+	})
+}
+
+func TestWaitForReplicaCount(t *testing.T) {
+	testApp := testAppDescription()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testApp.AppName,
+			Namespace: testNamespace,
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas: 1,
+		},
+	}
+
+	t.Run("scaled externally", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(deployment)
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		gets := 0
+		fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+			gets++
+			scaled := deployment.DeepCopy()
+			if gets > 2 {
+				scaled.Status.ReadyReplicas = 3
+			}
+			return true, scaled, nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.NoError(t, appManager.WaitForReplicaCount(ctx, 3))
+		assert.Equal(t, 3, gets)
+	})
+
+	t.Run("timeout reports last count", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := appManager.WaitForReplicaCount(ctx, 3)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "last ready: 1")
+	})
+
+	t.Run("poll timeout bounds the wait", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		err := appManager.WaitForReplicaCount(context.Background(), 3)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "last ready: 1")
+	})
+
+	t.Run("deployment not found", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		err := appManager.WaitForReplicaCount(context.Background(), 3)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "last ready")
+	})
+}
+
+func TestWaitForHPAScaleEvent(t *testing.T) {
+	testApp := testAppDescription()
+	cpuUtilization := int32(80)
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testApp.AppName,
+			Namespace: testNamespace,
+		},
+		Status: autoscalingv2beta2.HorizontalPodAutoscalerStatus{
+			DesiredReplicas: 3,
+			CurrentMetrics: []autoscalingv2beta2.MetricStatus{
+				{
+					Type: autoscalingv2beta2.ResourceMetricSourceType,
+					Resource: &autoscalingv2beta2.ResourceMetricStatus{
+						Name: apiv1.ResourceCPU,
+						Current: autoscalingv2beta2.MetricValueStatus{
+							AverageUtilization: &cpuUtilization,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("hpa scaled", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(hpa)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		metrics, err := appManager.WaitForHPAScaleEvent(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, hpa.Status.CurrentMetrics, metrics)
+	})
+
+	t.Run("hpa did not scale", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(hpa)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		metrics, err := appManager.WaitForHPAScaleEvent(ctx, 5)
+		assert.Error(t, err)
+		assert.Nil(t, metrics)
+	})
+
+	t.Run("poll timeout bounds the wait", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(hpa)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 100*time.Millisecond)
+
+		metrics, err := appManager.WaitForHPAScaleEvent(context.Background(), 5)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "desired: 3")
+		assert.Nil(t, metrics)
+	})
+}
+
+func TestGetNewestAndOldestPod(t *testing.T) {
+	testApp := testAppDescription()
+	now := time.Now()
+
+	newPod := func(name string, created time.Time) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         testNamespace,
+				CreationTimestamp: metav1.NewTime(created),
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+		}
+	}
+
+	t.Run("pods exist", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("middle", now.Add(-time.Minute)),
+			newPod("newest", now),
+			newPod("oldest", now.Add(-time.Hour)),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		newest, err := appManager.GetNewestPod(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "newest", newest.Name)
+
+		oldest, err := appManager.GetOldestPod(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "oldest", oldest.Name)
+	})
+
+	t.Run("no pods", func(t *testing.T) {
+		client := newDefaultFakeClient()
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		_, err := appManager.GetNewestPod(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestStreamContainerLogs(t *testing.T) {
+	testApp := testAppDescription()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{
+				{Name: testApp.AppName},
+				{Name: DaprSideCarName},
+			},
+		},
+	}
+
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(pod)}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var out bytes.Buffer
+	err := appManager.StreamContainerLogs(ctx, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "[testapp-pod/testapp] ")
+	assert.Contains(t, out.String(), "[testapp-pod/daprd] ")
+}
+
+func TestGetLogsContaining(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{Name: testApp.AppName},
+				},
+			},
+		}
+	}
+
+	// The fake clientset returns "fake logs" for every container
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod("testapp-pod-1"), newPod("testapp-pod-2"))}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 0)
+
+	t.Run("matches from all replicas", func(t *testing.T) {
+		lines, err := appManager.GetLogsContaining("fake")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			"[testapp-pod-1/testapp] fake logs",
+			"[testapp-pod-2/testapp] fake logs",
+		}, lines)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		lines, err := appManager.GetLogsContaining("subscription registered")
+		assert.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+
+	t.Run("wait for log line", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		lines, err := appManager.WaitForLogLine(ctx, "fake")
+		assert.NoError(t, err)
+		assert.Len(t, lines, 2)
+	})
+
+	t.Run("wait for log line times out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := appManager.WaitForLogLine(ctx, "subscription registered")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "[testapp-pod-1/testapp] fake logs")
+	})
+
+	t.Run("poll timeout bounds the wait", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(10*time.Millisecond, 100*time.Millisecond)
+
+		_, err := appManager.WaitForLogLine(context.Background(), "subscription registered")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "lines seen so far")
+		assert.Contains(t, err.Error(), "[testapp-pod-2/testapp] fake logs")
+	})
+}
+
+func TestGetResourceUsage(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.Replicas = 2
+
+	newPod := func(name string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+		}
+	}
+	newPodMetrics := func(name, appCPU, appMemory, sidecarCPU, sidecarMemory string) *metricsv1beta1.PodMetrics {
+		return &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+			},
+			Containers: []metricsv1beta1.ContainerMetrics{
+				{
+					Name: testApp.AppName,
+					Usage: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse(appCPU),
+						apiv1.ResourceMemory: resource.MustParse(appMemory),
+					},
+				},
+				{
+					Name: DaprSideCarName,
+					Usage: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse(sidecarCPU),
+						apiv1.ResourceMemory: resource.MustParse(sidecarMemory),
+					},
+				},
+			},
+		}
+	}
+
+	podMetrics := map[string]*metricsv1beta1.PodMetrics{
+		"pod-1": newPodMetrics("pod-1", "100m", "100Mi", "10m", "20Mi"),
+		"pod-2": newPodMetrics("pod-2", "300m", "50Mi", "20m", "10Mi"),
+	}
+	// extra containers are neither app nor sidecar
+	podMetrics["pod-1"].Containers = append(podMetrics["pod-1"].Containers, metricsv1beta1.ContainerMetrics{
+		Name: "auth-proxy",
+		Usage: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("900m"),
+			apiv1.ResourceMemory: resource.MustParse("900Mi"),
+		},
+	})
+	metricsClient := &metricsfake.Clientset{}
+	metricsClient.AddReactor(
+		getVerb,
+		"pods",
+		func(action core.Action) (bool, runtime.Object, error) {
+			return true, podMetrics[action.(core.GetAction).GetName()], nil
+		})
+
+	client := &KubeClient{
+		ClientSet:     fake.NewSimpleClientset(newPod("pod-1"), newPod("pod-2")),
+		MetricsClient: metricsClient,
+	}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("app usage per pod", func(t *testing.T) {
+		usages, err := appManager.GetResourceUsage(false)
+		assert.NoError(t, err)
+		assert.Len(t, usages, 2)
+
+		cpuByPod := map[string]int64{}
+		for _, usage := range usages {
+			assert.Equal(t, testApp.AppName, usage.ContainerName)
+			cpuByPod[usage.PodName] = usage.CPUm
+		}
+		assert.Equal(t, map[string]int64{"pod-1": 100, "pod-2": 300}, cpuByPod)
+	})
+
+	t.Run("all containers", func(t *testing.T) {
+		usages, err := appManager.GetAllResourceUsage()
+		assert.NoError(t, err)
+		assert.Len(t, usages, 5)
+	})
+
+	t.Run("maximum usage", func(t *testing.T) {
+		cpu, _, err := appManager.GetCPUAndMemory(true)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(20), cpu)
+
+		cpu, _, err = appManager.GetCPUAndMemory(false)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(300), cpu)
+	})
+
+	t.Run("without dapr", func(t *testing.T) {
+		app := testApp
+		app.DaprEnabled = false
+		appManager := NewAppManager(client, testNamespace, app)
+
+		pods, err := appManager.GetHostDetails()
+		assert.NoError(t, err)
+		assert.Len(t, pods, 2)
+
+		cpu, _, err := appManager.GetCPUAndMemory(false)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(300), cpu)
+
+		// Only the side car usage requires dapr
+		_, _, err = appManager.GetCPUAndMemory(true)
+		assert.Error(t, err)
+	})
+}
+
+func TestSampleResourceUsage(t *testing.T) {
+	testApp := testAppDescription()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-1",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+	}
+
+	var lock sync.Mutex
+	gets := 0
+	metricsClient := &metricsfake.Clientset{}
+	metricsClient.AddReactor(
+		getVerb,
+		"pods",
+		func(action core.Action) (bool, runtime.Object, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			gets++
+			// metrics-server hasn't scraped the pod on the first sample
+			if gets == 1 {
+				return true, nil, errors.NewNotFound(schema.GroupResource{Group: "metrics.k8s.io", Resource: "pods"}, "pod-1")
+			}
+			return true, &metricsv1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: testNamespace},
+				Containers: []metricsv1beta1.ContainerMetrics{
+					{
+						Name: testApp.AppName,
+						Usage: apiv1.ResourceList{
+							apiv1.ResourceCPU:    resource.MustParse(fmt.Sprintf("%dm", gets*10)),
+							apiv1.ResourceMemory: resource.MustParse("100Mi"),
+						},
+					},
+				},
+			}, nil
+		})
+
+	client := &KubeClient{
+		ClientSet:     fake.NewSimpleClientset(pod),
+		MetricsClient: metricsClient,
+	}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("samples over duration", func(t *testing.T) {
+		samples, err := appManager.SampleResourceUsage(context.Background(), 10*time.Millisecond, 55*time.Millisecond)
+		assert.NoError(t, err)
+		// The first sample is empty and dropped
+		assert.GreaterOrEqual(t, len(samples), 2)
+		assert.Equal(t, int64(20), samples[0].Usage[0].CPUm)
+		assert.Equal(t, "pod-1", samples[0].Usage[0].PodName)
+		assert.True(t, samples[0].Time.Before(samples[1].Time))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := appManager.SampleResourceUsage(ctx, 10*time.Millisecond, time.Second)
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestGetPodLogs(t *testing.T) {
+	testApp := testAppDescription()
+	fakeClient := fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+	})
+	var requested []*apiv1.PodLogOptions
+	var requestedPods []string
+	fakeClient.PrependReactor(getVerb, "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "log" {
+			requested = append(requested, action.(core.GenericAction).GetValue().(*apiv1.PodLogOptions))
+		}
+		return false, nil, nil
+	})
+	fakeClient.PrependReactor("list", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		requestedPods = append(requestedPods, "list")
+		return false, nil, nil
+	})
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp)
+
+	t.Run("since", func(t *testing.T) {
+		since := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+		logs, err := appManager.GetPodLogsSince("", "", since)
+		assert.NoError(t, err)
+		assert.Equal(t, "fake logs", logs)
+
+		opts := requested[len(requested)-1]
+		assert.Equal(t, testApp.AppName, opts.Container)
+		assert.True(t, since.Equal(opts.SinceTime.Time))
+		assert.Nil(t, opts.TailLines)
+		// The first running pod was looked up
+		assert.Len(t, requestedPods, 1)
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		logs, err := appManager.GetPodLogsTail("testapp-pod", DaprSideCarName, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, "fake logs", logs)
+
+		opts := requested[len(requested)-1]
+		assert.Equal(t, DaprSideCarName, opts.Container)
+		assert.Equal(t, int64(10), *opts.TailLines)
+		assert.Nil(t, opts.SinceTime)
+		assert.Len(t, requestedPods, 1)
+	})
+
+	t.Run("no running pod", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		_, err := appManager.GetPodLogsTail("", "", 10)
+		assert.Error(t, err)
+	})
+}
+
+func TestSaveContainerLogs(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, containers ...string) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+		}
+		for _, container := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{Name: container})
+		}
+		return pod
+	}
+
+	t.Run("logs of all pods and containers are saved", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", testApp.AppName, DaprSideCarName, "auth-proxy"),
+			newPod("testapp-pod-2", testApp.AppName, DaprSideCarName),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.SaveContainerLogs()
+		assert.NoError(t, err)
+
+		for _, name := range []string{
+			"testapp-pod-1.testapp.log",
+			"testapp-pod-1.daprd.log",
+			"testapp-pod-1.auth-proxy.log",
+			"testapp-pod-2.testapp.log",
+			"testapp-pod-2.daprd.log",
+		} {
+			content, err := os.ReadFile(appManager.logPrefix + "/" + name)
+			assert.NoError(t, err)
+			assert.Equal(t, "fake logs", string(content))
+		}
+	})
+
+	t.Run("logs are saved to an archive", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", testApp.AppName, DaprSideCarName),
+			newPod("testapp-pod-2", testApp.AppName),
+		)}
+		app := testAppDescription()
+		app.SaveContainerLogsArchive = true
+		appManager := NewAppManager(client, testNamespace, app)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.SaveContainerLogs()
+		assert.NoError(t, err)
+
+		entries, err := os.ReadDir(appManager.logPrefix)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		fh, err := os.Open(appManager.logPrefix + "/testapp.logs.tar.gz")
+		assert.NoError(t, err)
+		defer fh.Close()
+		gzr, err := gzip.NewReader(fh)
+		assert.NoError(t, err)
+		tr := tar.NewReader(gzr)
+
+		var names []string
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				break
+			}
+			names = append(names, header.Name)
+			content, err := ioutil.ReadAll(tr)
+			assert.NoError(t, err)
+			assert.Equal(t, "fake logs", string(content))
+		}
+		assert.ElementsMatch(t, []string{
+			"testapp-pod-1/testapp.log",
+			"testapp-pod-1/daprd.log",
+			"testapp-pod-2/testapp.log",
+		}, names)
+	})
+
+	t.Run("log snapshots are rotated", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", testApp.AppName),
+		)}
+		app := testAppDescription()
+		app.SaveContainerLogsSnapshots = true
+		app.MaxContainerLogSnapshots = 2
+		appManager := NewAppManager(client, testNamespace, app)
+		appManager.logPrefix = t.TempDir()
+
+		for i := 0; i < 3; i++ {
+			err := appManager.SaveContainerLogs()
+			assert.NoError(t, err)
+		}
+
+		entries, err := os.ReadDir(appManager.logPrefix)
+		assert.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.Equal(t, []string{"testapp-pod-1.testapp.0002.log", "testapp-pod-1.testapp.0003.log"}, names)
+	})
+
+	t.Run("dispose without logs skips saving", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", testApp.AppName, DaprSideCarName),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.DisposeWithoutLogs(false)
+		assert.NoError(t, err)
+
+		entries, err := os.ReadDir(appManager.logPrefix)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		err = appManager.Dispose(false)
+		assert.NoError(t, err)
+
+		entries, err = os.ReadDir(appManager.logPrefix)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("failed container doesn't stop the others", func(t *testing.T) {
+		// the file of a container with a slash in its name can't be created
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", "bad/container", testApp.AppName),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.SaveContainerLogs()
+		assert.Error(t, err)
+
+		_, err = os.Stat(appManager.logPrefix + "/testapp-pod-1.testapp.log")
+		assert.NoError(t, err)
+	})
+
+	t.Run("manifest records saved and failed logs", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", "bad/container", testApp.AppName),
+		)}
+		app := testAppDescription()
+		app.SaveContainerLogsManifest = true
+		appManager := NewAppManager(client, testNamespace, app)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.SaveContainerLogs()
+		assert.Error(t, err)
+
+		content, err := os.ReadFile(appManager.logPrefix + "/testapp.manifest.json")
+		assert.NoError(t, err)
+
+		var manifest containerLogManifest
+		assert.NoError(t, json.Unmarshal(content, &manifest))
+		assert.Equal(t, "testapp", manifest.App)
+		assert.Equal(t, testNamespace, manifest.Namespace)
+		assert.Len(t, manifest.Logs, 2)
+		assert.Equal(t, "bad/container", manifest.Logs[0].Container)
+		assert.NotEmpty(t, manifest.Logs[0].Error)
+		assert.Empty(t, manifest.Logs[0].File)
+		assert.Equal(t, "testapp", manifest.Logs[1].Container)
+		assert.Equal(t, "testapp-pod-1.testapp.log", manifest.Logs[1].File)
+		assert.Empty(t, manifest.Logs[1].Error)
+		assert.False(t, manifest.Logs[1].Timestamp.IsZero())
+	})
+
+	t.Run("no manifest by default", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", testApp.AppName),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.SaveContainerLogs()
+		assert.NoError(t, err)
+
+		_, err = os.Stat(appManager.logPrefix + "/testapp.manifest.json")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("previous logs of restarted containers are saved", func(t *testing.T) {
+		pod := newPod("testapp-pod-1", testApp.AppName, DaprSideCarName)
+		pod.Status.ContainerStatuses = []apiv1.ContainerStatus{
+			{Name: testApp.AppName, RestartCount: 2},
+			{Name: DaprSideCarName, RestartCount: 0},
+		}
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(pod)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.GetPreviousContainerLogs()
+		assert.NoError(t, err)
+
+		_, err = os.Stat(appManager.logPrefix + "/testapp-pod-1.testapp.previous.log")
+		assert.NoError(t, err)
+		_, err = os.Stat(appManager.logPrefix + "/testapp-pod-1.daprd.previous.log")
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(appManager.logPrefix + "/testapp-pod-1.testapp.log")
+		assert.True(t, os.IsNotExist(err))
+
+		err = appManager.SaveContainerLogs()
+		assert.NoError(t, err)
+
+		_, err = os.Stat(appManager.logPrefix + "/testapp-pod-1.testapp.log")
+		assert.NoError(t, err)
+	})
+}
+
+func TestWaitForHTTPStatus(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/healthz", r.URL.Path)
+		// the app becomes healthy on the third request
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	appManager := NewAppManager(newFakeKubeClient(), testNamespace, testAppDescription()).WithPollConfig(time.Millisecond, time.Second)
+
+	t.Run("expected status is observed", func(t *testing.T) {
+		err := appManager.waitForHTTPStatus(context.Background(), server.URL+"/healthz", http.StatusOK, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("expected status is never observed", func(t *testing.T) {
+		err := appManager.waitForHTTPStatus(context.Background(), server.URL+"/healthz", http.StatusNoContent, false)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "200 OK")
+	})
+
+	t.Run("non empty body is required", func(t *testing.T) {
+		metricsRequests := 0
+		metrics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			metricsRequests++
+			// the metrics are served on the second request
+			if metricsRequests > 1 {
+				fmt.Fprintln(w, "dapr_runtime_component_loaded 1")
+			}
+		}))
+		defer metrics.Close()
+
+		err := appManager.waitForHTTPStatus(context.Background(), metrics.URL+"/metrics", http.StatusOK, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, metricsRequests)
+	})
+
+	t.Run("connection refused is tolerated until timeout", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		err := appManager.waitForHTTPStatus(context.Background(), closed.URL+"/healthz", http.StatusOK, false)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "did not respond with status 200")
+	})
+}
+
+func TestStopPortForwarding(t *testing.T) {
+	appManager := NewAppManager(newFakeKubeClient(), testNamespace, testAppDescription())
+
+	t.Run("no forwarder", func(t *testing.T) {
+		err := appManager.StopPortForwarding("testapp-pod-1")
+		assert.Error(t, err)
+	})
+
+	forwarder := NewPodPortForwarder(appManager.client, testNamespace)
+	appManager.forwarder = forwarder
+	stop1, stop2 := make(chan struct{}), make(chan struct{})
+	forwarder.sessions["testapp-pod-1"] = []*portForwardSession{{localPorts: []int{40001}, stopChannel: stop1}}
+	forwarder.sessions["testapp-pod-2"] = []*portForwardSession{{localPorts: []int{40002, 40003}, stopChannel: stop2}}
+
+	t.Run("active forwards", func(t *testing.T) {
+		assert.Equal(t, map[string][]int{
+			"testapp-pod-1": {40001},
+			"testapp-pod-2": {40002, 40003},
+		}, forwarder.ActiveForwards())
+	})
+
+	t.Run("stop forwards to a single pod", func(t *testing.T) {
+		err := appManager.StopPortForwarding("testapp-pod-1")
+		assert.NoError(t, err)
+
+		_, open := <-stop1
+		assert.False(t, open)
+		assert.Equal(t, map[string][]int{"testapp-pod-2": {40002, 40003}}, forwarder.ActiveForwards())
+
+		err = appManager.StopPortForwarding("testapp-pod-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("close stops the remaining forwards", func(t *testing.T) {
+		err := forwarder.Close()
+		assert.NoError(t, err)
+
+		_, open := <-stop2
+		assert.False(t, open)
+		assert.Empty(t, forwarder.ActiveForwards())
+	})
+}
+
+func TestWaitUntilPodsRunning(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, phase apiv1.PodPhase, statuses ...apiv1.ContainerStatus) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Status: apiv1.PodStatus{
+				Phase:             phase,
+				PodIP:             "10.0.0.1",
+				ContainerStatuses: statuses,
+			},
+		}
+		for _, status := range statuses {
+			pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{Name: status.Name})
+		}
+		return pod
+	}
+
+	t.Run("all pods running", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.PodRunning,
+				apiv1.ContainerStatus{Name: testApp.AppName, Ready: true},
+				apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true}),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		pods, err := appManager.WaitUntilPodsRunning()
+		assert.NoError(t, err)
+		assert.Equal(t, []PodInfo{{Name: "testapp-pod-1", IP: "10.0.0.1"}}, pods)
+	})
+
+	t.Run("stuck pod is reported", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.PodRunning,
+				apiv1.ContainerStatus{Name: testApp.AppName, Ready: true},
+				apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true}),
+			newPod("testapp-pod-2", apiv1.PodRunning,
+				apiv1.ContainerStatus{Name: testApp.AppName, Ready: true},
+				apiv1.ContainerStatus{
+					Name: DaprSideCarName,
+					State: apiv1.ContainerState{
+						Waiting: &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+				}),
+			newPod("testapp-pod-3", apiv1.PodPending),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		_, err := appManager.WaitUntilPodsRunning()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "pod testapp-pod-2: daprd waiting: CrashLoopBackOff")
+		assert.Contains(t, err.Error(), "pod testapp-pod-3: phase Pending")
+		assert.NotContains(t, err.Error(), "testapp-pod-1")
+	})
+
+	t.Run("no pods", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		_, err := appManager.WaitUntilPodsRunning()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no running pods found")
+	})
+}
+
+func TestGetPodsBySelector(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, labels map[string]string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels:    labels,
+			},
+		}
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		newPod("testapp-pod-1", map[string]string{TestAppLabelKey: testApp.AppName}),
+		newPod("redis-0", map[string]string{"app": "redis", "role": "master"}),
+		newPod("redis-1", map[string]string{"app": "redis", "role": "replica"}),
+	)}
+
+	podNames := func(pods []PodInfo) []string {
+		names := []string{}
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+
+	t.Run("empty selectors default to the app pods", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		pods, err := appManager.GetPodsBySelector(" ")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"testapp-pod-1"}, podNames(pods))
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		pods, err := appManager.GetPodsBySelector("app=redis")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"redis-0", "redis-1"}, podNames(pods))
+	})
+
+	t.Run("app selector is combined with selector", func(t *testing.T) {
+		app := testAppDescription()
+		app.LabelSelector = "app=redis,"
+		appManager := NewAppManager(client, testNamespace, app)
+
+		pods, err := appManager.GetPodsBySelector("role=master")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"redis-0"}, podNames(pods))
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		_, err := appManager.GetPodsBySelector("app in redis")
+		assert.Error(t, err)
+	})
+}
+
+func TestJoinLabelSelectors(t *testing.T) {
+	assert.Equal(t, "", joinLabelSelectors())
+	assert.Equal(t, "", joinLabelSelectors("", " ", ","))
+	assert.Equal(t, "a=b", joinLabelSelectors("", "a=b"))
+	assert.Equal(t, "a=b,c in (d,e)", joinLabelSelectors("a=b,", " c in (d,e) "))
+}
+
+func TestServiceAccount(t *testing.T) {
+	client := newDefaultFakeClient()
+	appManager := NewAppManager(client, testNamespace, testAppDescription())
+
+	sa, err := appManager.CreateServiceAccount("testapp-sa")
+	assert.NoError(t, err)
+	assert.Equal(t, "testapp-sa", sa.Name)
+	assert.Equal(t, testNamespace, sa.Namespace)
+
+	err = appManager.DeleteServiceAccount("testapp-sa", false)
+	assert.NoError(t, err)
+
+	_, err = client.ServiceAccounts(testNamespace).Get(context.TODO(), "testapp-sa", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	assert.NoError(t, appManager.DeleteServiceAccount("testapp-sa", true))
+	assert.Error(t, appManager.DeleteServiceAccount("testapp-sa", false))
+}
+
+func TestScaleDown(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.Replicas = 2
+	newPod := func(name string, age time.Duration) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         testNamespace,
+				Labels:            map[string]string{TestAppLabelKey: testApp.AppName},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+		}
+	}
+
+	t.Run("newest pods are removed", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(newPod("testapp-old", time.Hour), newPod("testapp-new", time.Minute))
+		fakeClient.PrependReactor("*", "deployments", func(action core.Action) (bool, runtime.Object, error) {
+			if action.GetVerb() == updateVerb {
+				podsGVR := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+				assert.NoError(t, fakeClient.Tracker().Delete(podsGVR, testNamespace, "testapp-new"))
+			}
+			return true, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 2}}, nil
+		})
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		removed, err := appManager.ScaleDown(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"testapp-new"}, removed)
+		assert.Equal(t, int32(1), appManager.App().Replicas)
+	})
+
+	t.Run("replicas must decrease", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		_, err := appManager.ScaleDown(context.Background(), 2)
+		assert.Error(t, err)
+	})
+}
+
+func TestScaleDownCandidates(t *testing.T) {
+	pods := []apiv1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "testapp-2"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "testapp-10"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "testapp-0"}},
+	}
+
+	assert.Equal(t, []string{"testapp-10", "testapp-2"}, scaleDownCandidates(pods, 2, true))
+	assert.Empty(t, scaleDownCandidates(pods, 0, true))
+	assert.Len(t, scaleDownCandidates(pods, 5, false), 3)
+}
+
+func TestHPA(t *testing.T) {
+	testApp := testAppDescription()
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testApp.AppName,
+			Namespace: testNamespace,
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 3},
+	})}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("create", func(t *testing.T) {
+		err := appManager.CreateHPA(1, 5, 50)
+		assert.NoError(t, err)
+
+		hpa, err := client.HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Deployment", hpa.Spec.ScaleTargetRef.Kind)
+		assert.Equal(t, testApp.AppName, hpa.Spec.ScaleTargetRef.Name)
+		assert.Equal(t, int32(1), *hpa.Spec.MinReplicas)
+		assert.Equal(t, int32(5), hpa.Spec.MaxReplicas)
+		assert.Equal(t, int32(50), *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		assert.Error(t, appManager.CreateHPA(3, 2, 50))
+	})
+
+	t.Run("current replicas", func(t *testing.T) {
+		replicas, err := appManager.GetCurrentReplicas()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), replicas)
+	})
+
+	t.Run("deleted by dispose", func(t *testing.T) {
+		err := appManager.DisposeWithoutLogs(false)
+		assert.NoError(t, err)
+
+		_, err = client.HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		assert.NoError(t, appManager.DeleteHPA())
+	})
+}
+
+func TestGetImages(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, phase apiv1.PodPhase, sidecarImage string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{Name: testApp.AppName, Image: "dapriotest/helloworld"},
+					{Name: DaprSideCarName, Image: sidecarImage},
+				},
+			},
+			Status: apiv1.PodStatus{Phase: phase},
+		}
+	}
+
+	t.Run("running pod", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pending", apiv1.PodPending, "daprio/daprd:1.1.0"),
+			newPod("testapp-running", apiv1.PodRunning, "daprio/daprd:1.0.0"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		image, err := appManager.GetSidecarImage()
+		assert.NoError(t, err)
+		assert.Equal(t, "daprio/daprd:1.0.0", image)
+
+		image, err = appManager.GetAppImage()
+		assert.NoError(t, err)
+		assert.Equal(t, "dapriotest/helloworld", image)
+	})
+
+	t.Run("no running pods", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pending", apiv1.PodPending, "daprio/daprd:1.1.0"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		_, err := appManager.GetSidecarImage()
+		assert.Error(t, err)
+	})
+}
+
+func TestGetSidecarConfigName(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(annotations map[string]string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "testapp-pod",
+				Namespace:   testNamespace,
+				Annotations: annotations,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+		}
+	}
+
+	t.Run("config annotation", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(map[string]string{"dapr.io/config": "tracing"}))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		name, err := appManager.GetSidecarConfigName()
+		assert.NoError(t, err)
+		assert.Equal(t, "tracing", name)
+	})
+
+	t.Run("no config annotation", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(nil))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		name, err := appManager.GetSidecarConfigName()
+		assert.NoError(t, err)
+		assert.Empty(t, name)
+	})
+}
+
+func TestIsMTLSEnabled(t *testing.T) {
+	testApp := testAppDescription()
+	newConfig := func(enabled bool) *configurationv1alpha1.Configuration {
+		return &configurationv1alpha1.Configuration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      daprSystemConfigName,
+				Namespace: DaprTestNamespace,
+			},
+			Spec: configurationv1alpha1.ConfigurationSpec{
+				MTLSSpec: configurationv1alpha1.MTLSSpec{Enabled: enabled},
+			},
+		}
+	}
+
+	// The generated fake clientset looks configurations up in another API group than the one they are
+	// registered with, so they are created through the client instead of seeding the tracker
+	newClient := func(config *configurationv1alpha1.Configuration) *KubeClient {
+		client := &KubeClient{DaprClientSet: daprfake.NewSimpleClientset()}
+		_, err := client.DaprConfigurations(DaprTestNamespace).Create(config)
+		assert.NoError(t, err)
+		return client
+	}
+
+	t.Run("mtls enabled", func(t *testing.T) {
+		client := newClient(newConfig(true))
+		enabled, err := NewAppManager(client, testNamespace, testApp).IsMTLSEnabled()
+		assert.NoError(t, err)
+		assert.True(t, enabled)
+	})
+
+	t.Run("mtls disabled", func(t *testing.T) {
+		client := newClient(newConfig(false))
+		enabled, err := NewAppManager(client, testNamespace, testApp).IsMTLSEnabled()
+		assert.NoError(t, err)
+		assert.False(t, enabled)
+	})
+
+	t.Run("no configuration", func(t *testing.T) {
+		client := &KubeClient{DaprClientSet: daprfake.NewSimpleClientset()}
+		enabled, err := NewAppManager(client, testNamespace, testApp).IsMTLSEnabled()
+		assert.NoError(t, err)
+		assert.True(t, enabled)
+	})
+}
+
+func TestGetDaprAppID(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(annotations map[string]string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "testapp-pod",
+				Namespace:   testNamespace,
+				Annotations: annotations,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+		}
+	}
+
+	t.Run("app-id annotation", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(map[string]string{"dapr.io/app-id": "hello"}))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		appID, err := appManager.GetDaprAppID()
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", appID)
+	})
+
+	t.Run("no app-id annotation", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(nil))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		appID, err := appManager.GetDaprAppID()
+		assert.NoError(t, err)
+		assert.Equal(t, testApp.AppName, appID)
+	})
+
+	t.Run("empty app-id fails init", func(t *testing.T) {
+		app := testApp
+		app.PodAnnotations = map[string]string{"dapr.io/app-id": ""}
+		appManager := NewAppManager(newFakeKubeClient(), testNamespace, app)
+
+		err := appManager.InitWithContext(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "dapr.io/app-id annotation is empty")
+	})
+}
+
+func TestPDB(t *testing.T) {
+	testApp := testAppDescription()
+	client := newDefaultFakeClient()
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	err := appManager.CreatePDB(intstr.FromString("50%"))
+	assert.NoError(t, err)
+
+	pdb, err := client.PodDisruptionBudgets(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "50%", pdb.Spec.MinAvailable.StrVal)
+	assert.Equal(t, testApp.AppName, pdb.Spec.Selector.MatchLabels[TestAppLabelKey])
+
+	err = appManager.DisposeWithoutLogs(false)
+	assert.NoError(t, err)
+
+	_, err = client.PodDisruptionBudgets(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoError(t, appManager.DeletePDB())
+}
+
+func TestResourceQuota(t *testing.T) {
+	testApp := testAppDescription()
+	client := newDefaultFakeClient()
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	err := appManager.CreateResourceQuota(apiv1.ResourceQuotaSpec{
+		Hard: apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("2")},
+	})
+	assert.NoError(t, err)
+
+	quota, err := client.ResourceQuotas(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", quota.Spec.Hard.Pods().String())
+
+	// The quota controller updates the usage
+	quota.Status.Used = apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("1")}
+	_, err = client.ResourceQuotas(testNamespace).Update(context.TODO(), quota, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	used, err := appManager.GetResourceQuotaUsage()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", used.Pods().String())
+
+	err = appManager.DisposeWithoutLogs(false)
+	assert.NoError(t, err)
+
+	_, err = client.ResourceQuotas(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestReplicaFailure(t *testing.T) {
+	newDeployment := func(message string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			Status: appsv1.DeploymentStatus{
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:    appsv1.DeploymentReplicaFailure,
+						Status:  apiv1.ConditionTrue,
+						Reason:  "FailedCreate",
+						Message: message,
+					},
+				},
+			},
+		}
+	}
+
+	assert.Empty(t, replicaFailure(nil))
+	assert.Empty(t, replicaFailure(&appsv1.Deployment{}))
+	assert.Contains(t, replicaFailure(newDeployment(`pods "testapp-1" is forbidden: exceeded quota: testapp`)), "rejected by a ResourceQuota")
+	assert.Equal(t, "\nreplica failure: FailedCreate: no service account", replicaFailure(newDeployment("no service account")))
+}
+
+func TestDeletePod(t *testing.T) {
+	testApp := testAppDescription()
+	fakeClient := fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+		},
+	})
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp)
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, appManager.DeletePod("testapp-pod"))
+
+		_, err := fakeClient.CoreV1().Pods(testNamespace).Get(context.TODO(), "testapp-pod", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+
+		// deleting again is not an error
+		assert.NoError(t, appManager.DeletePod("testapp-pod"))
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		var evicted string
+		fakeClient.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			evicted = action.(core.CreateAction).GetObject().(*policyv1beta1.Eviction).Name
+			return true, nil, nil
+		})
+
+		assert.NoError(t, appManager.EvictPod("testapp-pod"))
+		assert.Equal(t, "testapp-pod", evicted)
+	})
+
+	t.Run("evict blocked by disruption budget", func(t *testing.T) {
+		fakeClient.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewTooManyRequests("cannot evict pod as it would violate the pod's disruption budget", 10)
+		})
+
+		err := appManager.EvictPod("testapp-pod")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "PodDisruptionBudget")
+	})
+}
+
+func TestGetPodByIndex(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.WorkloadType = WorkloadTypeStatefulSet
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-0",
+			Namespace: testNamespace,
+		},
+		Status: apiv1.PodStatus{PodIP: "10.0.0.1"},
+	})}
+
+	t.Run("existing ordinal", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		pod, err := appManager.GetPodByIndex(0)
+		assert.NoError(t, err)
+		assert.Equal(t, PodInfo{Name: "testapp-0", IP: "10.0.0.1"}, pod)
+	})
+
+	t.Run("missing ordinal", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		_, err := appManager.GetPodByIndex(1)
+		assert.Error(t, err)
+	})
+
+	t.Run("not a statefulset", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testAppDescription())
+
+		_, err := appManager.GetPodByIndex(0)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetNodeForPod(t *testing.T) {
+	testApp := testAppDescription()
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod-1",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec:   apiv1.PodSpec{NodeName: "node-1"},
+			Status: apiv1.PodStatus{PodIP: "10.0.0.1"},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod-2",
+				Namespace: testNamespace,
+			},
+		},
+	)}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("scheduled pod", func(t *testing.T) {
+		node, err := appManager.GetNodeForPod("testapp-pod-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "node-1", node)
+	})
+
+	t.Run("pending pod", func(t *testing.T) {
+		_, err := appManager.GetNodeForPod("testapp-pod-2")
+		assert.Error(t, err)
+	})
+
+	t.Run("missing pod", func(t *testing.T) {
+		_, err := appManager.GetNodeForPod("testapp-pod-3")
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("host details", func(t *testing.T) {
+		pods, err := appManager.GetHostDetails()
+		assert.NoError(t, err)
+		assert.Equal(t, []PodInfo{{Name: "testapp-pod-1", IP: "10.0.0.1", NodeName: "node-1"}}, pods)
+	})
+}
+
+func TestGetContainerState(t *testing.T) {
+	testApp := testAppDescription()
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+		},
+		Status: apiv1.PodStatus{
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: testApp.AppName,
+					State: apiv1.ContainerState{
+						Waiting: &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+				},
+			},
+		},
+	})}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+	t.Run("get", func(t *testing.T) {
+		state, err := appManager.GetContainerState("testapp-pod", testApp.AppName)
+		assert.NoError(t, err)
+		assert.Equal(t, "CrashLoopBackOff", state.Waiting.Reason)
+
+		_, err = appManager.GetContainerState("testapp-pod", DaprSideCarName)
+		assert.Error(t, err)
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		_, err := appManager.WaitForContainerState(context.Background(), "testapp-pod", testApp.AppName, func(state apiv1.ContainerState) bool {
+			return state.Waiting != nil && state.Waiting.Reason == "CrashLoopBackOff"
+		})
+		assert.NoError(t, err)
+
+		_, err = appManager.WaitForContainerState(context.Background(), "testapp-pod", testApp.AppName, func(state apiv1.ContainerState) bool {
+			return state.Terminated != nil
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestExecTarget(t *testing.T) {
+	testApp := testAppDescription()
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+	})}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	podName, containerName, err := appManager.execTarget(context.Background(), "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "testapp-pod", podName)
+	assert.Equal(t, testApp.AppName, containerName)
+
+	podName, containerName, err = appManager.execTarget(context.Background(), "other-pod", DaprSideCarName)
+	assert.NoError(t, err)
+	assert.Equal(t, "other-pod", podName)
+	assert.Equal(t, DaprSideCarName, containerName)
+
+	emptyManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+	_, _, err = emptyManager.execTarget(context.Background(), "", "")
+	assert.Error(t, err)
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0600))
+
+	t.Run("directory", func(t *testing.T) {
+		var archive bytes.Buffer
+		assert.NoError(t, writeTar(&archive, src, "fixtures"))
+
+		dst := filepath.Join(t.TempDir(), "out")
+		assert.NoError(t, extractTar(&archive, "fixtures", dst))
+
+		content, err := ioutil.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "b", string(content))
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		var archive bytes.Buffer
+		assert.NoError(t, writeTar(&archive, filepath.Join(src, "a.txt"), "result.txt"))
+
+		dst := filepath.Join(t.TempDir(), "copied.txt")
+		assert.NoError(t, extractTar(&archive, "result.txt", dst))
+
+		content, err := ioutil.ReadFile(dst)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", string(content))
+	})
+
+	t.Run("entries outside the source are dropped", func(t *testing.T) {
+		var archive bytes.Buffer
+		assert.NoError(t, writeTar(&archive, filepath.Join(src, "a.txt"), "fixtures/../evil.txt"))
+
+		dst := t.TempDir()
+		assert.NoError(t, extractTar(&archive, "fixtures", filepath.Join(dst, "out")))
+
+		_, err := os.Stat(filepath.Join(dst, "evil.txt"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestGetReplicaStatus(t *testing.T) {
+	testApp := testAppDescription()
+	deployment := buildDeploymentObject(testNamespace, testApp)
+	deployment.Status = appsv1.DeploymentStatus{
+		ReadyReplicas:       2,
+		AvailableReplicas:   1,
+		UpdatedReplicas:     3,
+		UnavailableReplicas: 2,
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment)}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("deployment status", func(t *testing.T) {
+		status, err := appManager.GetReplicaStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, ReplicaStatus{
+			Desired:     testApp.Replicas,
+			Ready:       2,
+			Available:   1,
+			Updated:     3,
+			Unavailable: 2,
+		}, status)
+	})
+
+	t.Run("deployment not found", func(t *testing.T) {
+		otherApp := testApp
+		otherApp.AppName = "otherapp"
+		_, err := NewAppManager(client, testNamespace, otherApp).GetReplicaStatus()
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestGetReadyEndpoints(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("no endpoints yet", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		ips, err := appManager.GetReadyEndpoints()
+		assert.NoError(t, err)
+		assert.Empty(t, ips)
+	})
+
+	t.Run("not ready addresses are excluded", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testApp.AppName,
+				Namespace: testNamespace,
+			},
+			Subsets: []apiv1.EndpointSubset{
+				{
+					Addresses:         []apiv1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+					NotReadyAddresses: []apiv1.EndpointAddress{{IP: "10.0.0.3"}},
+				},
+			},
+		})}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		ips, err := appManager.GetReadyEndpoints()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, ips)
+	})
+}
+
+func TestWaitUntil(t *testing.T) {
+	t.Run("condition is met", func(t *testing.T) {
+		calls := 0
+		err := WaitUntil(context.Background(), func() (bool, error) {
+			calls++
+			return calls == 3, nil
+		}, time.Millisecond, time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("condition error", func(t *testing.T) {
+		err := WaitUntil(context.Background(), func() (bool, error) {
+			return false, fmt.Errorf("boom")
+		}, time.Millisecond, time.Second)
+		assert.EqualError(t, err, "boom")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		err := WaitUntil(context.Background(), func() (bool, error) {
+			return false, nil
+		}, time.Millisecond, 10*time.Millisecond)
+		assert.Error(t, err)
+	})
+}
+
+func TestWaitUntilNoPods(t *testing.T) {
+	newPod := func(name, app string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: app,
+				},
+			},
+		}
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		newPod("testapp-pod", "testapp"),
+		newPod("otherapp-pod", "otherapp"),
+	)}
+
+	t.Run("no pods left", func(t *testing.T) {
+		err := WaitUntilNoPods(client, testNamespace, TestAppLabelKey+"=missingapp", 20*time.Millisecond)
+		assert.NoError(t, err)
+	})
+
+	t.Run("pods left", func(t *testing.T) {
+		err := WaitUntilNoPods(client, testNamespace, TestAppLabelKey+" in (testapp,otherapp)", 20*time.Millisecond)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "testapp-pod")
+		assert.Contains(t, err.Error(), "otherapp-pod")
+	})
+}
+
+func TestNamespaceCleanup(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("created namespace is deleted", func(t *testing.T) {
+		client := newDefaultFakeClient()
+		appManager := NewAppManager(client, testNamespace, testApp).WithNamespaceCleanup().WithPollConfig(time.Millisecond, time.Second)
+
+		_, err := appManager.GetOrCreateNamespace()
+		assert.NoError(t, err)
+
+		err = appManager.DisposeWithContext(context.Background(), true)
+		assert.NoError(t, err)
+
+		_, err = client.Namespaces().Get(context.TODO(), testNamespace, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("existing namespace is kept", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(buildNamespaceObject(testNamespace))}
+		appManager := NewAppManager(client, testNamespace, testApp).WithNamespaceCleanup().WithPollConfig(time.Millisecond, time.Second)
+
+		_, err := appManager.GetOrCreateNamespace()
+		assert.NoError(t, err)
+
+		err = appManager.DisposeWithContext(context.Background(), true)
+		assert.NoError(t, err)
+
+		_, err = client.Namespaces().Get(context.TODO(), testNamespace, metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("cleanup is opt in", func(t *testing.T) {
+		client := newDefaultFakeClient()
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		_, err := appManager.GetOrCreateNamespace()
+		assert.NoError(t, err)
+
+		err = appManager.DisposeWithContext(context.Background(), true)
+		assert.NoError(t, err)
+
+		_, err = client.Namespaces().Get(context.TODO(), testNamespace, metav1.GetOptions{})
+		assert.NoError(t, err)
+
+		err = appManager.DeleteNamespace(true)
+		assert.NoError(t, err)
+
+		_, err = client.Namespaces().Get(context.TODO(), testNamespace, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestValidateSidecarReady(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, sidecarStatus ...apiv1.ContainerStatus) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{Name: testApp.AppName},
+					{Name: DaprSideCarName},
+				},
+			},
+			Status: apiv1.PodStatus{
+				ContainerStatuses: sidecarStatus,
+			},
+		}
+	}
+	running := apiv1.ContainerState{Running: &apiv1.ContainerStateRunning{}}
+
+	t.Run("sidecar is ready", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true, State: running}),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		ok, err := appManager.ValidateSidecarReady()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("sidecar is not ready", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true, State: running}),
+			newPod("testapp-pod-2", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: false, State: running}),
+			newPod("testapp-pod-3", apiv1.ContainerStatus{Name: DaprSideCarName}),
+			newPod("testapp-pod-4"),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		ok, err := appManager.ValidateSidecarReady()
+		assert.False(t, ok)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "testapp-pod-1")
+		assert.Contains(t, err.Error(), "testapp-pod-2 (sidecar not ready)")
+		assert.Contains(t, err.Error(), "testapp-pod-3 (sidecar not running)")
+		assert.Contains(t, err.Error(), "testapp-pod-4 (no sidecar status)")
+	})
+
+	t.Run("wait until sidecar is ready", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true, State: running}),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.WaitUntilSidecarReady(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("wait until sidecar is ready times out", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+			newPod("testapp-pod-1", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: true, State: running}),
+			newPod("testapp-pod-2", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: false, State: running}),
+		)}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+		err := appManager.WaitUntilSidecarReady(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "testapp-pod-2 (sidecar not ready)")
+		assert.NotContains(t, err.Error(), "testapp-pod-1")
+	})
+
+	t.Run("init waits for sidecar without ingress", func(t *testing.T) {
+		app := testApp
+		app.IngressEnabled = false
+		os.Setenv(ContainerLogPathEnvVar, t.TempDir())
+		defer os.Unsetenv(ContainerLogPathEnvVar)
+
+		newInitClient := func(sidecarReady bool) *fake.Clientset {
+			fakeClient := fake.NewSimpleClientset(
+				newPod("testapp-pod-1", apiv1.ContainerStatus{Name: DaprSideCarName, Ready: sidecarReady, State: running}),
+			)
+			// The deployment is ready as soon as it is created
+			deploymentsResource := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+			fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+				obj, err := fakeClient.Tracker().Get(deploymentsResource, testNamespace, action.(core.GetAction).GetName())
+				if err != nil {
+					return true, nil, err
+				}
+				deployment := obj.(*appsv1.Deployment).DeepCopy()
+				deployment.Status.ReadyReplicas = *deployment.Spec.Replicas
+				deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+				return true, deployment, nil
+			})
+			return fakeClient
+		}
+
+		fakeClient := newInitClient(true)
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, app).WithPollConfig(time.Millisecond, time.Second)
+
+		assert.NoError(t, appManager.Init())
+		timings := appManager.Timings()
+		assert.NotZero(t, timings.DeployReady)
+		assert.NotZero(t, timings.Init)
+
+		services, err := fakeClient.CoreV1().Services(testNamespace).List(context.TODO(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		assert.Empty(t, services.Items)
+
+		appManager = NewAppManager(&KubeClient{ClientSet: newInitClient(false)}, testNamespace, app).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		err = appManager.Init()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "testapp-pod-1 (sidecar not ready)")
+	})
+
+	t.Run("wait can be skipped in init", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+		assert.False(t, appManager.skipSidecarReadyWait)
+		assert.True(t, appManager.WithoutSidecarReadyWait().skipSidecarReadyWait)
+	})
+}
+
+func TestGetContainerResources(t *testing.T) {
+	testApp := testAppDescription()
+	sidecarResources := apiv1.ResourceRequirements{
+		Limits: apiv1.ResourceList{
+			apiv1.ResourceCPU: resource.MustParse("300m"),
+		},
+		Requests: apiv1.ResourceList{
+			apiv1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-pod-1",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				TestAppLabelKey: testApp.AppName,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{
+				{Name: testApp.AppName},
+				{Name: DaprSideCarName, Resources: sidecarResources},
+			},
+		},
+	})}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("sidecar resources", func(t *testing.T) {
+		resources, err := appManager.GetContainerResources(DaprSideCarName)
+		assert.NoError(t, err)
+		assert.Equal(t, "300m", resources.Limits.Cpu().String())
+		assert.Equal(t, "64Mi", resources.Requests.Memory().String())
+	})
+
+	t.Run("no resources set", func(t *testing.T) {
+		resources, err := appManager.GetContainerResources(testApp.AppName)
+		assert.NoError(t, err)
+		assert.Empty(t, resources.Limits)
+		assert.Empty(t, resources.Requests)
+	})
+
+	t.Run("unknown container", func(t *testing.T) {
+		_, err := appManager.GetContainerResources("unknown")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetRestarts(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(name string, appRestarts, sidecarRestarts int32) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Status: apiv1.PodStatus{
+				ContainerStatuses: []apiv1.ContainerStatus{
+					{Name: testApp.AppName, RestartCount: appRestarts},
+					{Name: DaprSideCarName, RestartCount: sidecarRestarts},
+				},
+			},
+		}
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		newPod("testapp-pod-1", 2, 0),
+		newPod("testapp-pod-2", 1, 0),
+	)}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	t.Run("by pod", func(t *testing.T) {
+		restarts, err := appManager.GetRestartsByPod()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]map[string]int{
+			"testapp-pod-1": {testApp.AppName: 2, DaprSideCarName: 0},
+			"testapp-pod-2": {testApp.AppName: 1, DaprSideCarName: 0},
+		}, restarts)
+	})
+
+	t.Run("by container", func(t *testing.T) {
+		restarts, err := appManager.GetRestartsByContainer()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{testApp.AppName: 3, DaprSideCarName: 0}, restarts)
+	})
+
+	t.Run("total", func(t *testing.T) {
+		restarts, err := appManager.GetTotalRestarts()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, restarts)
+	})
+
+	t.Run("without dapr", func(t *testing.T) {
+		app := testApp
+		app.DaprEnabled = false
+		appManager := NewAppManager(client, testNamespace, app)
+
+		restarts, err := appManager.GetTotalRestarts()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, restarts)
+	})
+
+	t.Run("stable without restarts", func(t *testing.T) {
+		err := appManager.WithPollConfig(time.Millisecond, time.Second).WaitStableNoRestarts(context.Background(), 20*time.Millisecond)
+		assert.NoError(t, err)
+	})
+
+	t.Run("wait for restarts", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(newPod("testapp-pod-1", 2, 0), newPod("testapp-pod-2", 1, 0))
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			podsGVR := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+			assert.NoError(t, fakeClient.Tracker().Update(podsGVR, newPod("testapp-pod-2", 3, 0), testNamespace))
+		}()
+
+		restarted, err := appManager.WaitForRestarts(context.Background(), 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"container testapp of pod testapp-pod-2 (1 -> 3)"}, restarted)
+	})
+
+	t.Run("restarts before the call don't count", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		restarted, err := appManager.WaitForRestarts(context.Background(), 1)
+		assert.Error(t, err)
+		assert.Empty(t, restarted)
+	})
+
+	t.Run("restart within window", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(newPod("testapp-pod-1", 0, 0))
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			podsGVR := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+			assert.NoError(t, fakeClient.Tracker().Update(podsGVR, newPod("testapp-pod-1", 0, 1), testNamespace))
+		}()
+
+		err := appManager.WaitStableNoRestarts(context.Background(), time.Second)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "container daprd of pod testapp-pod-1 (0 -> 1)")
+	})
+}
+
+func TestInitContainerFailures(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.InitContainers = []apiv1.Container{
+		{Name: "migrate", Image: "migrate"},
+	}
+	newPod := func(name string, state apiv1.ContainerState, restarts int32) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Status: apiv1.PodStatus{
+				InitContainerStatuses: []apiv1.ContainerStatus{
+					{Name: "migrate", State: state, RestartCount: restarts},
+				},
+			},
+		}
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(
+		newPod("testapp-pod-1", apiv1.ContainerState{
+			Terminated: &apiv1.ContainerStateTerminated{Reason: "Completed"},
+		}, 0),
+		newPod("testapp-pod-2", apiv1.ContainerState{
+			Terminated: &apiv1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+		}, 3),
+		newPod("testapp-pod-3", apiv1.ContainerState{
+			Waiting: &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"},
+		}, 0),
+	)}
+
+	t.Run("failures are reported", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		failures := appManager.initContainerFailures()
+		assert.Contains(t, failures, "pod testapp-pod-2: init container migrate terminated: Error (exit code 1), restarts: 3")
+		assert.Contains(t, failures, "pod testapp-pod-3: init container migrate waiting: ImagePullBackOff")
+		assert.NotContains(t, failures, "testapp-pod-1")
+	})
+
+	t.Run("no init containers", func(t *testing.T) {
+		appManager := NewAppManager(client, testNamespace, testAppDescription())
+
+		assert.Empty(t, appManager.initContainerFailures())
+	})
+}
+
+func TestRelayUDP(t *testing.T) {
+	// echo server standing in for the port forward to the relay container
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			conn.Write(buf[:n])
+		}
+	}()
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer udpConn.Close()
+	go relayUDP(udpConn, listener.Addr().String())
+
+	client, err := net.Dial("udp", udpConn.LocalAddr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply := make([]byte, 16)
+	n, err := client.Read(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(reply[:n]))
+}
+
+func TestPortForwardUDP(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.UDPPorts = []int{8125}
+	appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+	_, err := appManager.PortForwardUDP("", 6831)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not in UDPPorts")
+}
+
+func TestServicePodTarget(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.AppPort = 8080
+	svc := buildServiceObject(testNamespace, testApp)
+
+	newPod := func(name string, phase apiv1.PodPhase, ready apiv1.ConditionStatus) apiv1.Pod {
+		return apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: apiv1.PodStatus{
+				Phase: phase,
+				Conditions: []apiv1.PodCondition{
+					{Type: apiv1.PodReady, Status: ready},
+				},
+			},
+		}
+	}
+
+	t.Run("ready pod and target port", func(t *testing.T) {
+		pods := []apiv1.Pod{
+			newPod("testapp-pod-1", apiv1.PodPending, apiv1.ConditionFalse),
+			newPod("testapp-pod-2", apiv1.PodRunning, apiv1.ConditionFalse),
+			newPod("testapp-pod-3", apiv1.PodRunning, apiv1.ConditionTrue),
+		}
+
+		podName, podPorts, err := servicePodTarget(svc, pods, []int{DefaultExternalPort})
+		assert.NoError(t, err)
+		assert.Equal(t, "testapp-pod-3", podName)
+		assert.Equal(t, []int{8080}, podPorts)
+	})
+
+	t.Run("unknown service port", func(t *testing.T) {
+		pods := []apiv1.Pod{newPod("testapp-pod-1", apiv1.PodRunning, apiv1.ConditionTrue)}
+
+		_, _, err := servicePodTarget(svc, pods, []int{9999})
+		assert.Error(t, err)
+	})
+
+	t.Run("no ready pods", func(t *testing.T) {
+		pods := []apiv1.Pod{newPod("testapp-pod-1", apiv1.PodRunning, apiv1.ConditionFalse)}
+
+		_, _, err := servicePodTarget(svc, pods, []int{DefaultExternalPort})
+		assert.Error(t, err)
+	})
+}
+
+func TestGetDeploymentConditions(t *testing.T) {
+	testApp := testAppDescription()
+	deployment := buildDeploymentObject(testNamespace, testApp)
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{
+		{
+			Type:    appsv1.DeploymentAvailable,
+			Status:  apiv1.ConditionTrue,
+			Reason:  "MinimumReplicasAvailable",
+			Message: "Deployment has minimum availability.",
+		},
+		{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  apiv1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "ReplicaSet \"testapp-5d9c\" has timed out progressing.",
+		},
+	}
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment)}
+	appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+	t.Run("conditions", func(t *testing.T) {
+		conditions, err := appManager.GetDeploymentConditions()
+		assert.NoError(t, err)
+		assert.Len(t, conditions, 2)
+		assert.Equal(t, "ProgressDeadlineExceeded", conditions[1].Reason)
+	})
+
+	t.Run("false conditions in timeout error", func(t *testing.T) {
+		_, err := appManager.WaitUntilDeploymentState(appManager.IsDeploymentDone)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Progressing: ProgressDeadlineExceeded: ReplicaSet \"testapp-5d9c\" has timed out progressing.")
+		assert.NotContains(t, err.Error(), "Available: MinimumReplicasAvailable")
+	})
+}
+
+func TestSidecarMetricsPort(t *testing.T) {
+	testApp := testAppDescription()
+
+	t.Run("default port", func(t *testing.T) {
+		port, err := NewAppManager(newFakeKubeClient(), testNamespace, testApp).sidecarMetricsPort()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSidecarMetricsPort, port)
+	})
+
+	t.Run("custom port", func(t *testing.T) {
+		app := testAppDescription()
+		app.MetricsPort = "9091"
+		port, err := NewAppManager(newFakeKubeClient(), testNamespace, app).sidecarMetricsPort()
+		assert.NoError(t, err)
+		assert.Equal(t, 9091, port)
+	})
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		app := testAppDescription()
+		app.MetricsEnabled = false
+		_, err := NewAppManager(newFakeKubeClient(), testNamespace, app).sidecarMetricsPort()
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `# HELP dapr_runtime_component_loaded The number of successfully loaded components.
+# TYPE dapr_runtime_component_loaded counter
+dapr_runtime_component_loaded{app_id="testapp",component="statestore"} 1
+dapr_runtime_component_loaded{app_id="testapp",component="pubsub"} 1
+`)
+	}))
+	defer server.Close()
+
+	t.Run("metric families are parsed", func(t *testing.T) {
+		families, err := fetchMetrics(server.URL + "/metrics")
+		assert.NoError(t, err)
+
+		family, ok := families["dapr_runtime_component_loaded"]
+		assert.True(t, ok)
+		assert.Len(t, family.GetMetric(), 2)
+		assert.Equal(t, float64(1), family.GetMetric()[0].GetCounter().GetValue())
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		_, err := fetchMetrics(server.URL + "/unknown")
+		assert.Error(t, err)
+	})
+}
+
+func TestJobWorkload(t *testing.T) {
+	testApp := testAppDescription()
+	testApp.WorkloadType = WorkloadTypeJob
+
+	t.Run("deploy and dispose", func(t *testing.T) {
+		client := newDefaultFakeClient()
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		_, err := appManager.Deploy()
+		assert.NoError(t, err)
+
+		job, err := client.Jobs(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, apiv1.RestartPolicyNever, job.Spec.Template.Spec.RestartPolicy)
+
+		err = appManager.ScaleDeploymentReplicaNoWait(2)
+		assert.Error(t, err)
+
+		err = appManager.DisposeWithContext(context.Background(), true)
+		assert.NoError(t, err)
+
+		_, err = client.Jobs(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	newJob := func(conditions ...batchv1.JobCondition) *batchv1.Job {
+		job := buildJobObject(testNamespace, testApp)
+		job.Status.Conditions = conditions
+		return job
+	}
+
+	t.Run("job complete", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newJob(batchv1.JobCondition{
+			Type:   batchv1.JobComplete,
+			Status: apiv1.ConditionTrue,
+		}))}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.WaitUntilJobComplete()
+		assert.NoError(t, err)
+	})
+
+	t.Run("job failed", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newJob(batchv1.JobCondition{
+			Type:    batchv1.JobFailed,
+			Status:  apiv1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		}))}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.WaitUntilJobComplete()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "BackoffLimitExceeded: Job has reached the specified backoff limit")
+	})
+
+	t.Run("job still running", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newJob())}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, 50*time.Millisecond)
+
+		err := appManager.WaitUntilJobComplete()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "is not in desired state")
+	})
+
+	t.Run("job logs", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-x7k2p",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					"job-name": testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{{Name: testApp.AppName}},
+			},
+		})}
+		appManager := NewAppManager(client, testNamespace, testApp)
+		appManager.logPrefix = t.TempDir()
+
+		err := appManager.GetJobLogs()
+		assert.NoError(t, err)
+
+		_, err = os.Stat(appManager.logPrefix + "/testapp-x7k2p.testapp.log")
+		assert.NoError(t, err)
+	})
+}
+
+func TestSetSidecarImage(t *testing.T) {
+	testApp := testAppDescription()
+	deployment := buildDeploymentObject(testNamespace, testApp)
+	deployment.Status = appsv1.DeploymentStatus{
+		Replicas:          testApp.Replicas,
+		UpdatedReplicas:   testApp.Replicas,
+		ReadyReplicas:     testApp.Replicas,
+		AvailableReplicas: testApp.Replicas,
+	}
+	newPod := func(containers ...apiv1.Container) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod-1",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{Containers: containers},
+		}
+	}
+
+	t.Run("override is unsupported", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment.DeepCopy(), newPod(
+			apiv1.Container{Name: testApp.AppName, Image: "dapriotest/helloworld"},
+			apiv1.Container{Name: DaprSideCarName, Image: "daprio/daprd:1.0.0"},
+		))}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.SetSidecarImage("daprio/daprd:1.1.0")
+		assert.True(t, stderrors.Is(err, ErrSidecarImageOverrideUnsupported))
+
+		d, err := client.Deployments(testNamespace).Get(context.TODO(), testApp.AppName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, deployment.Spec.Template, d.Spec.Template)
+	})
+
+	t.Run("sidecar is not injected", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment.DeepCopy(), newPod(
+			apiv1.Container{Name: testApp.AppName, Image: "dapriotest/helloworld"},
+		))}
+		appManager := NewAppManager(client, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+		err := appManager.SetSidecarImage("daprio/daprd:1.1.0")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot find dapr sidecar in pod testapp-pod-1")
+
+		assert.False(t, stderrors.Is(err, ErrSidecarImageOverrideUnsupported))
+	})
+}
+
+func TestGetSidecarPorts(t *testing.T) {
+	testApp := testAppDescription()
+	newPod := func(containers ...apiv1.Container) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod-1",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+			Spec: apiv1.PodSpec{Containers: containers},
+		}
+	}
+
+	t.Run("declared ports", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(apiv1.Container{
+			Name: DaprSideCarName,
+			Ports: []apiv1.ContainerPort{
+				{Name: "dapr-http", ContainerPort: 3600},
+				{Name: "dapr-grpc", ContainerPort: 50011},
+			},
+		}))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		port, err := appManager.GetSidecarHTTPPort()
+		assert.NoError(t, err)
+		assert.Equal(t, 3600, port)
+
+		port, err = appManager.GetSidecarGRPCPort()
+		assert.NoError(t, err)
+		assert.Equal(t, 50011, port)
+	})
+
+	t.Run("default ports", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(apiv1.Container{Name: DaprSideCarName}))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		port, err := appManager.GetSidecarHTTPPort()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSidecarHTTPPort, port)
+
+		port, err = appManager.GetSidecarGRPCPort()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSidecarGRPCPort, port)
+	})
+
+	t.Run("no sidecar", func(t *testing.T) {
+		client := &KubeClient{ClientSet: fake.NewSimpleClientset(newPod(apiv1.Container{Name: testApp.AppName}))}
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		_, err := appManager.GetSidecarHTTPPort()
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyComponent(t *testing.T) {
+	testApp := testAppDescription()
+	component := []byte(`
+apiVersion: dapr.io/v1alpha1
+kind: Component
+metadata:
+  name: statestore
+spec:
+  type: state.redis
+  version: v1
+`)
+
+	newClient := func() *KubeClient {
+		return &KubeClient{
+			ClientSet:     fake.NewSimpleClientset(),
+			DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		}
+	}
+
+	t.Run("apply and dispose", func(t *testing.T) {
+		client := newClient()
+		appManager := NewAppManager(client, testNamespace, testApp)
+
+		assert.NoError(t, appManager.ApplyComponent(component))
+		// Applying again updates the existing component
+		assert.NoError(t, appManager.ApplyComponent(component))
+
+		obj, err := client.DynamicClient.Resource(daprComponentsResource).Namespace(testNamespace).Get(context.TODO(), "statestore", metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "state.redis", obj.Object["spec"].(map[string]interface{})["type"])
+		assert.Len(t, appManager.appliedResources, 1)
+
+		assert.NoError(t, appManager.Dispose(false))
+
+		_, err = client.DynamicClient.Resource(daprComponentsResource).Namespace(testNamespace).Get(context.TODO(), "statestore", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		assert.Empty(t, appManager.appliedResources)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		appManager := NewAppManager(newClient(), testNamespace, testApp)
+
+		assert.NoError(t, appManager.ApplyComponent(component))
+		assert.NoError(t, appManager.DeleteComponent("statestore"))
+		assert.Empty(t, appManager.appliedResources)
+
+		// Deleting a missing component is not an error
+		assert.NoError(t, appManager.DeleteComponent("statestore"))
+	})
+
+	t.Run("wrong kind", func(t *testing.T) {
+		appManager := NewAppManager(newClient(), testNamespace, testApp)
+
+		err := appManager.ApplyComponent([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"))
+		assert.Error(t, err)
+		assert.Empty(t, appManager.appliedResources)
+	})
+}
+
+func TestApplyConfiguration(t *testing.T) {
+	testApp := testAppDescription()
+	configuration := []byte(`
+apiVersion: dapr.io/v1alpha1
+kind: Configuration
+metadata:
+  name: tracing
+spec:
+  tracing:
+    samplingRate: "1"
+`)
+	client := &KubeClient{
+		ClientSet:     fake.NewSimpleClientset(),
+		DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+	}
+	configurations := client.DynamicClient.Resource(daprConfigurationsResource).Namespace(testNamespace)
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	assert.NoError(t, appManager.ApplyConfiguration(configuration))
+	_, err := configurations.Get(context.TODO(), "tracing", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// A component is not a configuration
+	err = appManager.ApplyConfiguration([]byte("apiVersion: dapr.io/v1alpha1\nkind: Component\nmetadata:\n  name: statestore\n"))
+	assert.Error(t, err)
+
+	assert.NoError(t, appManager.Dispose(false))
+	_, err = configurations.Get(context.TODO(), "tracing", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	assert.NoError(t, appManager.ApplyConfiguration(configuration))
+	assert.NoError(t, appManager.DeleteConfiguration("tracing"))
+	assert.Empty(t, appManager.appliedResources)
+}
+
+func TestDialGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+
+	server := grpc.NewServer()
+	go server.Serve(listener)
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dialGRPC(ctx, listener.Addr().String())
+	assert.NoError(t, err)
+	assert.Equal(t, connectivity.Ready, conn.GetState())
+	conn.Close()
+
+	t.Run("no server", func(t *testing.T) {
+		server.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := dialGRPC(ctx, listener.Addr().String())
+		assert.Error(t, err)
+	})
+}
+
+func TestDescribeState(t *testing.T) {
+	testApp := testAppDescription()
+	replicas := int32(2)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testApp.AppName,
+			Namespace: testNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas:       1,
+			UnavailableReplicas: 1,
+		},
+	}
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testapp-0",
+			Namespace: testNamespace,
+			Labels:    map[string]string{TestAppLabelKey: testApp.AppName},
+		},
+		Spec: apiv1.PodSpec{NodeName: "node-1"},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name:  testApp.AppName,
+					Ready: true,
+					State: apiv1.ContainerState{Running: &apiv1.ContainerStateRunning{}},
+				},
+				{
+					Name:         DaprSideCarName,
+					RestartCount: 3,
+					State:        apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				},
+			},
+		},
+	}
+	warning := &apiv1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "backoff", Namespace: testNamespace},
+		InvolvedObject: apiv1.ObjectReference{Kind: "Pod", Name: "testapp-0"},
+		Type:           apiv1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+	}
+	normal := &apiv1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "pulled", Namespace: testNamespace},
+		InvolvedObject: apiv1.ObjectReference{Kind: "Pod", Name: "testapp-0"},
+		Type:           apiv1.EventTypeNormal,
+		Reason:         "Pulled",
+	}
+
+	client := &KubeClient{ClientSet: fake.NewSimpleClientset(deployment, pod, warning, normal)}
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	state, err := appManager.DescribeState()
+	assert.NoError(t, err)
+	assert.Equal(t, ReplicaStatus{Desired: 2, Ready: 1, Unavailable: 1}, state.Replicas)
+	assert.Equal(t, []PodState{{
+		Name:     "testapp-0",
+		NodeName: "node-1",
+		Phase:    apiv1.PodRunning,
+		Containers: []ContainerState{
+			{Name: testApp.AppName, Ready: true, State: "running"},
+			{Name: DaprSideCarName, RestartCount: 3, State: "waiting: CrashLoopBackOff"},
+		},
+	}}, state.Pods)
+	assert.Len(t, state.WarningEvents, 1)
+	assert.Equal(t, "BackOff", state.WarningEvents[0].Reason)
+	assert.Contains(t, state.String(), "container daprd: waiting: CrashLoopBackOff, ready: false, restarts: 3")
+
+	t.Run("not deployed", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		state, err := appManager.DescribeState()
+		assert.NoError(t, err)
+		assert.Empty(t, state.Pods)
+		assert.Empty(t, state.WarningEvents)
+	})
+}
+
+func TestApplyNetworkPolicy(t *testing.T) {
+	testApp := testAppDescription()
+	policy := []byte(`
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-egress
+spec:
+  podSelector:
+    matchLabels:
+      testapp: testapp
+  policyTypes:
+  - Egress
+`)
+	client := &KubeClient{
+		ClientSet:     fake.NewSimpleClientset(),
+		DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+	}
+	policies := client.DynamicClient.Resource(networkPoliciesResource).Namespace(testNamespace)
+	appManager := NewAppManager(client, testNamespace, testApp)
+
+	assert.NoError(t, appManager.ApplyNetworkPolicy(policy))
+	_, err := policies.Get(context.TODO(), "deny-egress", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, appManager.Dispose(false))
+	_, err = policies.Get(context.TODO(), "deny-egress", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+
+	assert.NoError(t, appManager.ApplyNetworkPolicy(policy))
+	assert.NoError(t, appManager.DeleteNetworkPolicy("deny-egress"))
+	assert.Empty(t, appManager.appliedResources)
+}
+
+func TestForceDeleteAfter(t *testing.T) {
+	testApp := testAppDescription()
+	podsResource := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	newClient := func() *fake.Clientset {
+		fakeClient := fake.NewSimpleClientset(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testapp-pod",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					TestAppLabelKey: testApp.AppName,
+				},
+			},
+		})
+		// The deployment is kept by foreground deletion until its pod is gone
+		fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+			if _, err := fakeClient.Tracker().Get(podsResource, testNamespace, "testapp-pod"); err != nil {
+				return true, nil, err
+			}
+			return true, &appsv1.Deployment{}, nil
+		})
+		return fakeClient
+	}
+
+	t.Run("stuck pod is force deleted", func(t *testing.T) {
+		fakeClient := newClient()
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).
+			WithPollConfig(time.Millisecond, time.Second).
+			WithForceDeleteAfter(20 * time.Millisecond)
+
+		assert.NoError(t, appManager.DisposeWithoutLogs(true))
+
+		_, err := fakeClient.Tracker().Get(podsResource, testNamespace, "testapp-pod")
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		fakeClient := newClient()
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).
+			WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+		assert.Error(t, appManager.DisposeWithoutLogs(true))
+
+		_, err := fakeClient.Tracker().Get(podsResource, testNamespace, "testapp-pod")
+		assert.NoError(t, err)
+	})
+}
+
+func TestGetClusterIP(t *testing.T) {
+	testApp := testAppDescription()
+	newService := func(clusterIP string) *apiv1.Service {
+		return &apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testApp.AppName,
+				Namespace: testNamespace,
+			},
+			Spec: apiv1.ServiceSpec{
+				ClusterIP: clusterIP,
+			},
+		}
+	}
+
+	appManager := NewAppManager(&KubeClient{ClientSet: fake.NewSimpleClientset(newService("10.0.0.12"))}, testNamespace, testApp)
+	assert.Equal(t, "testapp.apputil-test.svc", appManager.GetServiceDNSName())
+
+	clusterIP, err := appManager.GetClusterIP()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.12", clusterIP)
+
+	t.Run("headless service", func(t *testing.T) {
+		appManager := NewAppManager(&KubeClient{ClientSet: fake.NewSimpleClientset(newService(apiv1.ClusterIPNone))}, testNamespace, testApp)
+
+		_, err := appManager.GetClusterIP()
+		assert.Error(t, err)
+	})
+
+	t.Run("no service", func(t *testing.T) {
+		appManager := NewAppManager(newDefaultFakeClient(), testNamespace, testApp)
+
+		_, err := appManager.GetClusterIP()
+		assert.True(t, errors.IsNotFound(err))
+	})
+}
+
+func TestWaitForObservedGeneration(t *testing.T) {
+	testApp := testAppDescription()
+	fakeClient := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       testApp.AppName,
+			Namespace:  testNamespace,
+			Generation: 1,
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+		},
+	})
+	// The API server bumps the generation on spec changes
+	fakeClient.PrependReactor("patch", "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		return true, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: testApp.AppName, Generation: 2}}, nil
+	})
+	gets := 0
+	fakeClient.PrependReactor(getVerb, "deployments", func(action core.Action) (bool, runtime.Object, error) {
+		gets++
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: testApp.AppName, Generation: 2}}
+		deployment.Status.ObservedGeneration = 1
+		if gets > 2 {
+			deployment.Status.ObservedGeneration = 2
+		}
+		return true, deployment, nil
+	})
+	appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, time.Second)
+
+	generation, err := appManager.PatchDeployment([]byte(`{"spec":{"template":{"metadata":{"annotations":{"key":"value"}}}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), generation)
+
+	assert.NoError(t, appManager.WaitForObservedGeneration(generation))
+	assert.Equal(t, 3, gets)
+
+	t.Run("not observed", func(t *testing.T) {
+		appManager := NewAppManager(&KubeClient{ClientSet: fakeClient}, testNamespace, testApp).WithPollConfig(time.Millisecond, 20*time.Millisecond)
+
+		assert.Error(t, appManager.WaitForObservedGeneration(3))
+	})
+}
@@ -10,9 +10,14 @@ import (
 
 	daprclient "github.com/dapr/dapr/pkg/client/clientset/versioned"
 	componentsv1alpha1 "github.com/dapr/dapr/pkg/client/clientset/versioned/typed/components/v1alpha1"
+	configurationv1alpha1 "github.com/dapr/dapr/pkg/client/clientset/versioned/typed/configuration/v1alpha1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	appv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	autoscalingv2beta2 "k8s.io/client-go/kubernetes/typed/autoscaling/v2beta2"
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	apiv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	policyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
@@ -25,6 +30,8 @@ type KubeClient struct {
 	ClientSet     kubernetes.Interface
 	MetricsClient metrics.Interface
 	DaprClientSet daprclient.Interface
+	// DynamicClient applies resources given as YAML, e.g. Dapr components
+	DynamicClient dynamic.Interface
 	clientConfig  *rest.Config
 }
 
@@ -50,7 +57,12 @@ func NewKubeClient(configPath string, clusterName string) (*KubeClient, error) {
 		return nil, err
 	}
 
-	return &KubeClient{ClientSet: kubecs, DaprClientSet: daprcs, clientConfig: config, MetricsClient: metricscs}, nil
+	dynamiccs, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubeClient{ClientSet: kubecs, DaprClientSet: daprcs, DynamicClient: dynamiccs, clientConfig: config, MetricsClient: metricscs}, nil
 }
 
 func clientConfig(kubeConfigPath string, clusterName string) (*rest.Config, error) {
@@ -81,11 +93,31 @@ func (c *KubeClient) Deployments(namespace string) appv1.DeploymentInterface {
 	return c.ClientSet.AppsV1().Deployments(namespace)
 }
 
+// ReplicaSets gets ReplicaSet client for namespace
+func (c *KubeClient) ReplicaSets(namespace string) appv1.ReplicaSetInterface {
+	return c.ClientSet.AppsV1().ReplicaSets(namespace)
+}
+
+// StatefulSets gets StatefulSet client for namespace
+func (c *KubeClient) StatefulSets(namespace string) appv1.StatefulSetInterface {
+	return c.ClientSet.AppsV1().StatefulSets(namespace)
+}
+
+// Jobs gets Job client for namespace
+func (c *KubeClient) Jobs(namespace string) batchv1.JobInterface {
+	return c.ClientSet.BatchV1().Jobs(namespace)
+}
+
 // Services gets Service client for namespace
 func (c *KubeClient) Services(namespace string) apiv1.ServiceInterface {
 	return c.ClientSet.CoreV1().Services(namespace)
 }
 
+// Endpoints gets Endpoints client for namespace
+func (c *KubeClient) Endpoints(namespace string) apiv1.EndpointsInterface {
+	return c.ClientSet.CoreV1().Endpoints(namespace)
+}
+
 // Pods gets Pod client for namespace
 func (c *KubeClient) Pods(namespace string) apiv1.PodInterface {
 	return c.ClientSet.CoreV1().Pods(namespace)
@@ -96,7 +128,37 @@ func (c *KubeClient) Namespaces() apiv1.NamespaceInterface {
 	return c.ClientSet.CoreV1().Namespaces()
 }
 
+// ServiceAccounts gets ServiceAccount client for namespace
+func (c *KubeClient) ServiceAccounts(namespace string) apiv1.ServiceAccountInterface {
+	return c.ClientSet.CoreV1().ServiceAccounts(namespace)
+}
+
+// Events gets Event client for namespace
+func (c *KubeClient) Events(namespace string) apiv1.EventInterface {
+	return c.ClientSet.CoreV1().Events(namespace)
+}
+
+// HorizontalPodAutoscalers gets HorizontalPodAutoscaler client for namespace
+func (c *KubeClient) HorizontalPodAutoscalers(namespace string) autoscalingv2beta2.HorizontalPodAutoscalerInterface {
+	return c.ClientSet.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace)
+}
+
+// PodDisruptionBudgets gets PodDisruptionBudget client for namespace
+func (c *KubeClient) PodDisruptionBudgets(namespace string) policyv1beta1.PodDisruptionBudgetInterface {
+	return c.ClientSet.PolicyV1beta1().PodDisruptionBudgets(namespace)
+}
+
+// ResourceQuotas gets ResourceQuota client for namespace
+func (c *KubeClient) ResourceQuotas(namespace string) apiv1.ResourceQuotaInterface {
+	return c.ClientSet.CoreV1().ResourceQuotas(namespace)
+}
+
 // DaprComponents gets Dapr component client for namespace
 func (c *KubeClient) DaprComponents(namespace string) componentsv1alpha1.ComponentInterface {
 	return c.DaprClientSet.ComponentsV1alpha1().Components(namespace)
 }
+
+// DaprConfigurations gets Dapr configuration client for namespace
+func (c *KubeClient) DaprConfigurations(namespace string) configurationv1alpha1.ConfigurationInterface {
+	return c.DaprClientSet.ConfigurationV1alpha1().Configurations(namespace)
+}
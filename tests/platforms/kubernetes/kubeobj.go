@@ -7,12 +7,19 @@ package kubernetes
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	v1alpha1 "github.com/dapr/dapr/pkg/apis/components/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -22,11 +29,24 @@ const (
 	TestAppLabelKey = "testapp"
 	// DaprSideCarName is the Pod name of Dapr side car
 	DaprSideCarName = "daprd"
+	// UDPRelayContainerName is the name of the container relaying port forwards to the UDP ports of the app
+	UDPRelayContainerName = "udp-relay"
+
+	// udpRelayImage is the image of the UDP relay container
+	udpRelayImage = "alpine/socat"
+	// udpRelayBasePort is the TCP port the relay listens on for the first UDP port
+	udpRelayBasePort = 45000
 
 	// DefaultContainerPort is the default container port exposed from test app
 	DefaultContainerPort = 3000
 	// DefaultExternalPort is the default external port exposed by load balancer ingress
 	DefaultExternalPort = 3000
+	// DefaultSidecarMetricsPort is the default port of the Dapr side car metrics endpoint
+	DefaultSidecarMetricsPort = 9090
+	// DefaultSidecarHTTPPort is the default port of the Dapr side car HTTP API
+	DefaultSidecarHTTPPort = 3500
+	// DefaultSidecarGRPCPort is the default port of the Dapr side car gRPC API
+	DefaultSidecarGRPCPort = 50001
 
 	// DaprComponentsKind is component kind
 	DaprComponentsKind = "components.dapr.io"
@@ -34,6 +54,14 @@ const (
 	// DaprTestNamespaceEnvVar is the environment variable for setting the Kubernetes namespace for e2e tests
 	DaprTestNamespaceEnvVar = "DAPR_TEST_NAMESPACE"
 
+	// TestRunIDEnvVar is the environment variable for setting the ID of the test run, see TestRunID
+	TestRunIDEnvVar = "DAPR_TEST_RUN_ID"
+
+	// TestNamespaceLabelKey marks the namespaces created by the tests
+	TestNamespaceLabelKey = "dapr-e2e-test"
+	// TestRunIDLabelKey holds the ID of the test run which created a namespace
+	TestRunIDLabelKey = "dapr-e2e-run-id"
+
 	// Environment variable for setting Kubernetes node affinity OS
 	TargetOsEnvVar = "TARGET_OS"
 
@@ -41,6 +69,12 @@ const (
 	TargetArchEnvVar = "TARGET_ARCH"
 )
 
+// daprReservedEnvVars are set on the app container by the Dapr sidecar injector and can't be overridden
+var daprReservedEnvVars = map[string]bool{
+	"DAPR_HTTP_PORT": true,
+	"DAPR_GRPC_PORT": true,
+}
+
 var (
 	// DaprTestNamespace is the default Kubernetes namespace for e2e tests
 	DaprTestNamespace = "dapr-tests"
@@ -50,20 +84,89 @@ var (
 
 	// TargetArch is the default architecture affinity for Kubernetes nodes
 	TargetArch = "amd64"
+
+	// TestRunID identifies the namespaces created by this test run, defaults to the start time of the run
+	TestRunID = strconv.FormatInt(time.Now().Unix(), 10)
 )
 
 // buildDeploymentObject creates the Kubernetes Deployment object for dapr test app
 func buildDeploymentObject(namespace string, appDesc AppDescription) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(appDesc.Replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					TestAppLabelKey: appDesc.AppName,
+				},
+			},
+			Template: buildPodTemplateSpec(appDesc),
+		},
+	}
+}
+
+// buildStatefulSetObject creates the Kubernetes StatefulSet object for dapr test app
+func buildStatefulSetObject(namespace string, appDesc AppDescription) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: int32Ptr(appDesc.Replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					TestAppLabelKey: appDesc.AppName,
+				},
+			},
+			// The app service gives the pods their stable network identities
+			ServiceName:         appDesc.AppName,
+			PodManagementPolicy: appsv1.OrderedReadyPodManagement,
+			Template:            buildPodTemplateSpec(appDesc),
+		},
+	}
+}
+
+// buildJobObject creates the Kubernetes Job object for dapr test app, which runs Replicas pods to completion
+func buildJobObject(namespace string, appDesc AppDescription) *batchv1.Job {
+	template := buildPodTemplateSpec(appDesc)
+	template.Spec.RestartPolicy = apiv1.RestartPolicyNever
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism: int32Ptr(appDesc.Replicas),
+			Completions: int32Ptr(appDesc.Replicas),
+			// Failed runs are reported instead of retried
+			BackoffLimit: int32Ptr(0),
+			Template:     template,
+		},
+	}
+}
+
+// buildPodTemplateSpec creates the pod template shared by the workloads of dapr test app
+func buildPodTemplateSpec(appDesc AppDescription) apiv1.PodTemplateSpec {
 	annotationObject := map[string]string{}
 
 	if appDesc.AppPort == 0 { // If AppPort is negative, assume this has been set explicitly
 		appDesc.AppPort = DefaultContainerPort
 	}
 
+	appID := appDesc.AppID
+	if appID == "" {
+		appID = appDesc.AppName
+	}
+
 	if appDesc.DaprEnabled {
 		annotationObject = map[string]string{
 			"dapr.io/enabled":                           "true",
-			"dapr.io/app-id":                            appDesc.AppName,
+			"dapr.io/app-id":                            appID,
 			"dapr.io/app-port":                          fmt.Sprintf("%d", appDesc.AppPort),
 			"dapr.io/sidecar-cpu-limit":                 appDesc.DaprCPULimit,
 			"dapr.io/sidecar-cpu-request":               appDesc.DaprCPURequest,
@@ -83,78 +186,197 @@ func buildDeploymentObject(namespace string, appDesc AppDescription) *appsv1.Dep
 	if appDesc.Config != "" {
 		annotationObject["dapr.io/config"] = appDesc.Config
 	}
-
-	appEnv := []apiv1.EnvVar{}
-	if appDesc.AppEnv != nil {
-		for key, value := range appDesc.AppEnv {
-			appEnv = append(appEnv, apiv1.EnvVar{
-				Name:  key,
-				Value: value,
-			})
+	if appDesc.DaprEnabled {
+		for key, value := range buildSidecarAnnotations(appDesc.SidecarOptions) {
+			annotationObject[key] = value
 		}
 	}
+	for key, value := range appDesc.PodAnnotations {
+		annotationObject[key] = value
+	}
 
-	return &appsv1.Deployment{
+	podLabels := map[string]string{}
+	for key, value := range appDesc.PodLabels {
+		podLabels[key] = value
+	}
+	// The app selectors rely on the testapp label
+	podLabels[TestAppLabelKey] = appDesc.AppName
+
+	appEnv, appEnvFrom := buildAppEnv(appDesc)
+
+	pullPolicy := appDesc.ImagePullPolicy
+	if pullPolicy == "" {
+		pullPolicy = apiv1.PullAlways
+	}
+
+	var pullSecrets []apiv1.LocalObjectReference
+	for _, secret := range appDesc.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, apiv1.LocalObjectReference{Name: secret})
+	}
+
+	containers := []apiv1.Container{
+		{
+			Name:            appDesc.AppName,
+			Image:           fmt.Sprintf("%s/%s", appDesc.RegistryName, appDesc.ImageName),
+			ImagePullPolicy: pullPolicy,
+			Command:         appDesc.AppCommand,
+			Args:            appDesc.AppArgs,
+			Ports:           buildContainerPorts(appDesc),
+			Env:             appEnv,
+			EnvFrom:         appEnvFrom,
+			ReadinessProbe:  appDesc.ReadinessProbe,
+			LivenessProbe:   appDesc.LivenessProbe,
+		},
+	}
+	containers = append(containers, appDesc.ExtraContainers...)
+	if len(appDesc.UDPPorts) > 0 {
+		containers = append(containers, buildUDPRelayContainer(appDesc.UDPPorts))
+	}
+
+	return apiv1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      appDesc.AppName,
-			Namespace: namespace,
+			Labels:      podLabels,
+			Annotations: annotationObject,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: int32Ptr(appDesc.Replicas),
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					TestAppLabelKey: appDesc.AppName,
-				},
-			},
-			Template: apiv1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						TestAppLabelKey: appDesc.AppName,
-					},
-					Annotations: annotationObject,
-				},
-				Spec: apiv1.PodSpec{
-					Containers: []apiv1.Container{
+		Spec: apiv1.PodSpec{
+			ServiceAccountName:            appDesc.ServiceAccountName,
+			ImagePullSecrets:              pullSecrets,
+			InitContainers:                appDesc.InitContainers,
+			Containers:                    containers,
+			NodeSelector:                  appDesc.NodeSelector,
+			Tolerations:                   appDesc.Tolerations,
+			Affinity:                      buildAffinity(appDesc),
+			PriorityClassName:             appDesc.PriorityClassName,
+			TerminationGracePeriodSeconds: appDesc.TerminationGracePeriodSeconds,
+			HostAliases:                   appDesc.HostAliases,
+			DNSConfig:                     appDesc.DNSConfig,
+		},
+	}
+}
+
+// buildAffinity creates the affinity of the app pods, which pins them to the target OS and architecture
+// unless Affinity is given, and spreads them across nodes if SpreadAcrossNodes is set
+func buildAffinity(appDesc AppDescription) *apiv1.Affinity {
+	var affinity *apiv1.Affinity
+	if appDesc.Affinity != nil {
+		affinity = appDesc.Affinity.DeepCopy()
+	} else {
+		affinity = &apiv1.Affinity{
+			NodeAffinity: &apiv1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+					NodeSelectorTerms: []apiv1.NodeSelectorTerm{
 						{
-							Name:            appDesc.AppName,
-							Image:           fmt.Sprintf("%s/%s", appDesc.RegistryName, appDesc.ImageName),
-							ImagePullPolicy: apiv1.PullAlways,
-							Ports: []apiv1.ContainerPort{
+							MatchExpressions: []apiv1.NodeSelectorRequirement{
 								{
-									Name:          "http",
-									Protocol:      apiv1.ProtocolTCP,
-									ContainerPort: DefaultContainerPort,
+									Key:      "kubernetes.io/os",
+									Operator: "In",
+									Values:   []string{TargetOs},
 								},
-							},
-							Env: appEnv,
-						},
-					},
-					Affinity: &apiv1.Affinity{
-						NodeAffinity: &apiv1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
-								NodeSelectorTerms: []apiv1.NodeSelectorTerm{
-									{
-										MatchExpressions: []apiv1.NodeSelectorRequirement{
-											{
-												Key:      "kubernetes.io/os",
-												Operator: "In",
-												Values:   []string{TargetOs},
-											},
-											{
-												Key:      "kubernetes.io/arch",
-												Operator: "In",
-												Values:   []string{TargetArch},
-											},
-										},
-									},
+								{
+									Key:      "kubernetes.io/arch",
+									Operator: "In",
+									Values:   []string{TargetArch},
 								},
 							},
 						},
 					},
 				},
 			},
-		},
+		}
+	}
+
+	if appDesc.SpreadAcrossNodes {
+		if affinity.PodAntiAffinity == nil {
+			affinity.PodAntiAffinity = &apiv1.PodAntiAffinity{}
+		}
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			apiv1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						TestAppLabelKey: appDesc.AppName,
+					},
+				},
+				TopologyKey: "kubernetes.io/hostname",
+			})
+	}
+
+	return affinity
+}
+
+// buildSidecarAnnotations translates the side car options into dapr.io annotations, skipping unset fields
+func buildSidecarAnnotations(opts SidecarOptions) map[string]string {
+	annotations := map[string]string{}
+	setString := func(key, value string) {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+
+	setString("dapr.io/sidecar-cpu-limit", opts.CPULimit)
+	setString("dapr.io/sidecar-cpu-request", opts.CPURequest)
+	setString("dapr.io/sidecar-memory-limit", opts.MemoryLimit)
+	setString("dapr.io/sidecar-memory-request", opts.MemoryRequest)
+	setString("dapr.io/log-level", opts.LogLevel)
+	if opts.LogAsJSON != nil {
+		annotations["dapr.io/log-as-json"] = strconv.FormatBool(*opts.LogAsJSON)
+	}
+	if opts.EnableProfiling != nil {
+		annotations["dapr.io/enable-profiling"] = strconv.FormatBool(*opts.EnableProfiling)
+	}
+	if opts.AppMaxConcurrency != nil {
+		annotations["dapr.io/app-max-concurrency"] = strconv.Itoa(*opts.AppMaxConcurrency)
+	}
+	if opts.HTTPMaxRequestSize != nil {
+		annotations["dapr.io/http-max-request-size"] = strconv.Itoa(*opts.HTTPMaxRequestSize)
+	}
+
+	return annotations
+}
+
+// buildAppEnv creates the environment of the test app container, skipping the variables reserved by Dapr
+func buildAppEnv(appDesc AppDescription) ([]apiv1.EnvVar, []apiv1.EnvFromSource) {
+	appEnv := []apiv1.EnvVar{}
+	for key, value := range appDesc.AppEnv {
+		if daprReservedEnvVars[key] {
+			log.Printf("Ignoring environment variable %s of %s which is reserved by Dapr", key, appDesc.AppName)
+			continue
+		}
+		appEnv = append(appEnv, apiv1.EnvVar{
+			Name:  key,
+			Value: value,
+		})
+	}
+
+	for key, secretKey := range appDesc.AppEnvFromSecret {
+		if daprReservedEnvVars[key] {
+			log.Printf("Ignoring environment variable %s of %s which is reserved by Dapr", key, appDesc.AppName)
+			continue
+		}
+		secretKey := secretKey
+		appEnv = append(appEnv, apiv1.EnvVar{
+			Name: key,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &secretKey,
+			},
+		})
 	}
+
+	// Keep the pod spec stable across runs
+	sort.Slice(appEnv, func(i, j int) bool {
+		return appEnv[i].Name < appEnv[j].Name
+	})
+
+	var appEnvFrom []apiv1.EnvFromSource
+	for _, secret := range appDesc.AppEnvSecrets {
+		appEnvFrom = append(appEnvFrom, apiv1.EnvFromSource{
+			SecretRef: &apiv1.SecretEnvSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: secret},
+			},
+		})
+	}
+
+	return appEnv, appEnvFrom
 }
 
 // buildServiceObject creates the Kubernetes Service Object for dapr test app
@@ -170,6 +392,38 @@ func buildServiceObject(namespace string, appDesc AppDescription) *apiv1.Service
 		targetPort = appDesc.AppPort
 	}
 
+	ports := []apiv1.ServicePort{
+		{
+			Protocol:   apiv1.ProtocolTCP,
+			Port:       DefaultExternalPort,
+			TargetPort: intstr.IntOrString{IntVal: int32(targetPort)},
+		},
+	}
+
+	if len(appDesc.Ports) > 0 {
+		// Explicit ports are exposed on the same service port
+		ports = ports[:0]
+		for _, port := range appPorts(appDesc) {
+			ports = append(ports, apiv1.ServicePort{
+				Name:       port.Name,
+				Protocol:   port.Protocol,
+				Port:       int32(port.ContainerPort),
+				TargetPort: intstr.IntOrString{IntVal: int32(port.ContainerPort)},
+			})
+		}
+	} else if len(appDesc.ExtraPorts) > 0 {
+		// Every port of a multi-port service must be named
+		ports[0].Name = "http"
+		for _, port := range appDesc.ExtraPorts {
+			ports = append(ports, apiv1.ServicePort{
+				Name:       extraPortName(port),
+				Protocol:   apiv1.ProtocolTCP,
+				Port:       int32(port),
+				TargetPort: intstr.IntOrString{IntVal: int32(port)},
+			})
+		}
+	}
+
 	return &apiv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      appDesc.AppName,
@@ -182,18 +436,101 @@ func buildServiceObject(namespace string, appDesc AppDescription) *apiv1.Service
 			Selector: map[string]string{
 				TestAppLabelKey: appDesc.AppName,
 			},
-			Ports: []apiv1.ServicePort{
-				{
-					Protocol:   apiv1.ProtocolTCP,
-					Port:       DefaultExternalPort,
-					TargetPort: intstr.IntOrString{IntVal: int32(targetPort)},
-				},
-			},
-			Type: serviceType,
+			Ports: ports,
+			Type:  serviceType,
 		},
 	}
 }
 
+// buildContainerPorts creates the ports of the test app container
+func buildContainerPorts(appDesc AppDescription) []apiv1.ContainerPort {
+	var ports []apiv1.ContainerPort
+	if len(appDesc.Ports) > 0 {
+		for _, port := range appPorts(appDesc) {
+			ports = append(ports, apiv1.ContainerPort{
+				Name:          port.Name,
+				Protocol:      port.Protocol,
+				ContainerPort: int32(port.ContainerPort),
+			})
+		}
+	} else {
+		ports = append(ports, apiv1.ContainerPort{
+			Name:          "http",
+			Protocol:      apiv1.ProtocolTCP,
+			ContainerPort: DefaultContainerPort,
+		})
+		for _, port := range appDesc.ExtraPorts {
+			ports = append(ports, apiv1.ContainerPort{
+				Name:          extraPortName(port),
+				Protocol:      apiv1.ProtocolTCP,
+				ContainerPort: int32(port),
+			})
+		}
+	}
+
+	for _, port := range appDesc.UDPPorts {
+		ports = append(ports, apiv1.ContainerPort{
+			Name:          fmt.Sprintf("udp-%d", port),
+			Protocol:      apiv1.ProtocolUDP,
+			ContainerPort: int32(port),
+		})
+	}
+
+	return ports
+}
+
+// udpRelayPort returns the TCP port of the relay container forwarding to the i-th UDP port of the app
+func udpRelayPort(i int) int {
+	return udpRelayBasePort + i
+}
+
+// buildUDPRelayContainer creates the container relaying TCP connections to the UDP ports of the app,
+// one socat process per port. socat sends whatever it reads from the TCP stream as one datagram,
+// which is why ConnectUDP only supports one datagram in flight.
+func buildUDPRelayContainer(udpPorts []int) apiv1.Container {
+	relays := make([]string, 0, len(udpPorts))
+	ports := make([]apiv1.ContainerPort, 0, len(udpPorts))
+	for i, port := range udpPorts {
+		relays = append(relays, fmt.Sprintf("socat TCP-LISTEN:%d,fork,reuseaddr UDP:127.0.0.1:%d &", udpRelayPort(i), port))
+		ports = append(ports, apiv1.ContainerPort{
+			Name:          fmt.Sprintf("udp-relay-%d", i),
+			Protocol:      apiv1.ProtocolTCP,
+			ContainerPort: int32(udpRelayPort(i)),
+		})
+	}
+
+	return apiv1.Container{
+		Name:    UDPRelayContainerName,
+		Image:   udpRelayImage,
+		Command: []string{"sh", "-c", strings.Join(relays, " ") + " wait"},
+		Ports:   ports,
+	}
+}
+
+// extraPortName returns the name of an extra port, which is unique within the app
+func extraPortName(port int) string {
+	return fmt.Sprintf("port-%d", port)
+}
+
+// appPorts returns the explicit ports of the app with the default name and protocol filled in
+func appPorts(appDesc AppDescription) []AppPort {
+	ports := make([]AppPort, 0, len(appDesc.Ports))
+	for _, port := range appDesc.Ports {
+		if port.Protocol == "" {
+			port.Protocol = apiv1.ProtocolTCP
+		}
+		if port.Name == "" {
+			port.Name = extraPortName(port.ContainerPort)
+			if port.Protocol == apiv1.ProtocolUDP {
+				port.Name = fmt.Sprintf("udp-%d", port.ContainerPort)
+			}
+		}
+		ports = append(ports, port)
+	}
+
+	return ports
+}
+
 // buildDaprComponentObject creates dapr component object
 func buildDaprComponentObject(componentName string, typeName string, metaData []v1alpha1.MetadataItem) *v1alpha1.Component {
 	return &v1alpha1.Component{
@@ -212,7 +549,94 @@ func buildDaprComponentObject(componentName string, typeName string, metaData []
 
 // buildNamespaceObject creates the Kubernetes Namespace object
 func buildNamespaceObject(namespace string) *apiv1.Namespace {
-	return &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	return &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+			Labels: map[string]string{
+				TestNamespaceLabelKey: "true",
+				TestRunIDLabelKey:     TestRunID,
+			},
+		},
+	}
+}
+
+// buildHPAObject creates the HorizontalPodAutoscaler object scaling the app workload of kind on CPU utilization
+func buildHPAObject(namespace string, appDesc AppDescription, kind string, minReplicas, maxReplicas, targetCPUPercent int32) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	return &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				TestAppLabelKey: appDesc.AppName,
+			},
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       kind,
+				Name:       appDesc.AppName,
+			},
+			MinReplicas: int32Ptr(minReplicas),
+			MaxReplicas: maxReplicas,
+			Metrics: []autoscalingv2beta2.MetricSpec{
+				{
+					Type: autoscalingv2beta2.ResourceMetricSourceType,
+					Resource: &autoscalingv2beta2.ResourceMetricSource{
+						Name: apiv1.ResourceCPU,
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:               autoscalingv2beta2.UtilizationMetricType,
+							AverageUtilization: int32Ptr(targetCPUPercent),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildPDBObject creates the PodDisruptionBudget object protecting the pods of the app
+func buildPDBObject(namespace string, appDesc AppDescription, minAvailable intstr.IntOrString) *policyv1beta1.PodDisruptionBudget {
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				TestAppLabelKey: appDesc.AppName,
+			},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					TestAppLabelKey: appDesc.AppName,
+				},
+			},
+		},
+	}
+}
+
+// buildResourceQuotaObject creates the ResourceQuota object constraining the app namespace
+func buildResourceQuotaObject(namespace string, appDesc AppDescription, spec apiv1.ResourceQuotaSpec) *apiv1.ResourceQuota {
+	return &apiv1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appDesc.AppName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				TestAppLabelKey: appDesc.AppName,
+			},
+		},
+		Spec: spec,
+	}
+}
+
+// buildServiceAccountObject creates the Kubernetes ServiceAccount object
+func buildServiceAccountObject(namespace string, name string) *apiv1.ServiceAccount {
+	return &apiv1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
 }
 
 func int32Ptr(i int32) *int32 {
@@ -223,6 +647,9 @@ func init() {
 	if ns, ok := os.LookupEnv(DaprTestNamespaceEnvVar); ok {
 		DaprTestNamespace = ns
 	}
+	if runID, ok := os.LookupEnv(TestRunIDEnvVar); ok {
+		TestRunID = runID
+	}
 	if os, ok := os.LookupEnv(TargetOsEnvVar); ok {
 		TargetOs = os
 	}
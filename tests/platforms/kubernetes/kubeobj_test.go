@@ -10,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestBuildDeploymentObject(t *testing.T) {
@@ -34,6 +35,298 @@ func TestBuildDeploymentObject(t *testing.T) {
 		assert.Equal(t, "true", obj.Spec.Template.Annotations["dapr.io/enabled"])
 	})
 
+	t.Run("App environment", func(t *testing.T) {
+		app := testApp
+		app.AppEnv = map[string]string{
+			"LOG_LEVEL":      "debug",
+			"DAPR_HTTP_PORT": "1234",
+		}
+		app.AppEnvFromSecret = map[string]apiv1.SecretKeySelector{
+			"CONNECTION_STRING": {
+				LocalObjectReference: apiv1.LocalObjectReference{Name: "redis"},
+				Key:                  "connection-string",
+			},
+		}
+		app.AppEnvSecrets = []string{"feature-flags"}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		container := obj.Spec.Template.Spec.Containers[0]
+		assert.Len(t, container.Env, 2)
+		assert.Equal(t, "CONNECTION_STRING", container.Env[0].Name)
+		assert.Equal(t, "redis", container.Env[0].ValueFrom.SecretKeyRef.Name)
+		assert.Equal(t, "connection-string", container.Env[0].ValueFrom.SecretKeyRef.Key)
+		assert.Equal(t, apiv1.EnvVar{Name: "LOG_LEVEL", Value: "debug"}, container.Env[1])
+		assert.Len(t, container.EnvFrom, 1)
+		assert.Equal(t, "feature-flags", container.EnvFrom[0].SecretRef.Name)
+	})
+
+	t.Run("Pod annotations and labels", func(t *testing.T) {
+		app := testApp
+		app.DaprEnabled = true
+		app.PodAnnotations = map[string]string{
+			"dapr.io/log-level":      "debug",
+			"dapr.io/enable-metrics": "false",
+		}
+		app.PodLabels = map[string]string{
+			"team":          "actors",
+			TestAppLabelKey: "other",
+		}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		annotations := obj.Spec.Template.Annotations
+		assert.Equal(t, "debug", annotations["dapr.io/log-level"])
+		assert.Equal(t, "false", annotations["dapr.io/enable-metrics"])
+		assert.Equal(t, "true", annotations["dapr.io/enabled"])
+		assert.Equal(t, "actors", obj.Spec.Template.Labels["team"])
+		assert.Equal(t, "testapp", obj.Spec.Template.Labels[TestAppLabelKey])
+	})
+
+	t.Run("Init containers", func(t *testing.T) {
+		app := testApp
+		app.InitContainers = []apiv1.Container{
+			{Name: "wait-for-redis", Image: "busybox"},
+		}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Len(t, obj.Spec.Template.Spec.InitContainers, 1)
+		assert.Equal(t, "wait-for-redis", obj.Spec.Template.Spec.InitContainers[0].Name)
+	})
+
+	t.Run("Service account", func(t *testing.T) {
+		app := testApp
+		app.ServiceAccountName = "testapp-sa"
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Equal(t, "testapp-sa", obj.Spec.Template.Spec.ServiceAccountName)
+		assert.Empty(t, buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec.ServiceAccountName)
+	})
+
+	t.Run("Image pull policy and secrets", func(t *testing.T) {
+		defaultObj := buildDeploymentObject("testNamespace", testApp)
+		assert.Equal(t, apiv1.PullAlways, defaultObj.Spec.Template.Spec.Containers[0].ImagePullPolicy)
+		assert.Empty(t, defaultObj.Spec.Template.Spec.ImagePullSecrets)
+
+		app := testApp
+		app.ImagePullPolicy = apiv1.PullIfNotPresent
+		app.ImagePullSecrets = []string{"registry-credentials"}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Equal(t, apiv1.PullIfNotPresent, obj.Spec.Template.Spec.Containers[0].ImagePullPolicy)
+		assert.Equal(t, []apiv1.LocalObjectReference{{Name: "registry-credentials"}}, obj.Spec.Template.Spec.ImagePullSecrets)
+	})
+
+	t.Run("Command and args", func(t *testing.T) {
+		defaultContainer := buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec.Containers[0]
+		assert.Empty(t, defaultContainer.Command)
+		assert.Empty(t, defaultContainer.Args)
+
+		app := testApp
+		app.AppCommand = []string{"/app"}
+		app.AppArgs = []string{"--mode", "subscriber"}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		container := obj.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, []string{"/app"}, container.Command)
+		assert.Equal(t, []string{"--mode", "subscriber"}, container.Args)
+	})
+
+	t.Run("UDP ports", func(t *testing.T) {
+		app := testApp
+		app.UDPPorts = []int{8125, 6831}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		containers := obj.Spec.Template.Spec.Containers
+		assert.Len(t, containers, 2)
+		assert.Equal(t, apiv1.ProtocolUDP, containers[0].Ports[1].Protocol)
+		assert.Equal(t, int32(8125), containers[0].Ports[1].ContainerPort)
+
+		relay := containers[1]
+		assert.Equal(t, UDPRelayContainerName, relay.Name)
+		assert.Contains(t, relay.Command[2], "socat TCP-LISTEN:45000,fork,reuseaddr UDP:127.0.0.1:8125")
+		assert.Contains(t, relay.Command[2], "socat TCP-LISTEN:45001,fork,reuseaddr UDP:127.0.0.1:6831")
+		assert.Equal(t, int32(45001), relay.Ports[1].ContainerPort)
+	})
+
+	t.Run("Extra containers", func(t *testing.T) {
+		app := testApp
+		app.ExtraContainers = []apiv1.Container{{Name: "auth-proxy", Image: "envoyproxy/envoy"}}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		containers := obj.Spec.Template.Spec.Containers
+		assert.Len(t, containers, 2)
+		assert.Equal(t, app.AppName, containers[0].Name)
+		assert.Equal(t, "auth-proxy", containers[1].Name)
+	})
+
+	t.Run("Node selector and tolerations", func(t *testing.T) {
+		app := testApp
+		app.NodeSelector = map[string]string{"agentpool": "gpu"}
+		app.Tolerations = []apiv1.Toleration{
+			{Key: "sku", Operator: apiv1.TolerationOpEqual, Value: "gpu", Effect: apiv1.TaintEffectNoSchedule},
+		}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Equal(t, map[string]string{"agentpool": "gpu"}, obj.Spec.Template.Spec.NodeSelector)
+		assert.Equal(t, app.Tolerations, obj.Spec.Template.Spec.Tolerations)
+		assert.Nil(t, buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec.Tolerations)
+	})
+
+	t.Run("Priority class and grace period", func(t *testing.T) {
+		gracePeriod := int64(60)
+		app := testApp
+		app.PriorityClassName = "high-priority"
+		app.TerminationGracePeriodSeconds = &gracePeriod
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Equal(t, "high-priority", obj.Spec.Template.Spec.PriorityClassName)
+		assert.Equal(t, int64(60), *obj.Spec.Template.Spec.TerminationGracePeriodSeconds)
+
+		defaultSpec := buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec
+		assert.Empty(t, defaultSpec.PriorityClassName)
+		assert.Nil(t, defaultSpec.TerminationGracePeriodSeconds)
+	})
+
+	t.Run("Host aliases and DNS config", func(t *testing.T) {
+		app := testApp
+		app.HostAliases = []apiv1.HostAlias{{IP: "10.0.0.10", Hostnames: []string{"broker.test"}}}
+		app.DNSConfig = &apiv1.PodDNSConfig{Searches: []string{"test.svc.cluster.local"}}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		assert.Equal(t, app.HostAliases, obj.Spec.Template.Spec.HostAliases)
+		assert.Equal(t, app.DNSConfig, obj.Spec.Template.Spec.DNSConfig)
+
+		defaultSpec := buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec
+		assert.Nil(t, defaultSpec.HostAliases)
+		assert.Nil(t, defaultSpec.DNSConfig)
+	})
+
+	t.Run("Affinity", func(t *testing.T) {
+		defaultAffinity := buildDeploymentObject("testNamespace", testApp).Spec.Template.Spec.Affinity
+		assert.NotNil(t, defaultAffinity.NodeAffinity)
+		assert.Nil(t, defaultAffinity.PodAntiAffinity)
+
+		app := testApp
+		app.SpreadAcrossNodes = true
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		affinity := obj.Spec.Template.Spec.Affinity
+		assert.NotNil(t, affinity.NodeAffinity)
+		terms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		assert.Len(t, terms, 1)
+		assert.Equal(t, "kubernetes.io/hostname", terms[0].TopologyKey)
+		assert.Equal(t, app.AppName, terms[0].LabelSelector.MatchLabels[TestAppLabelKey])
+
+		app.Affinity = &apiv1.Affinity{PodAffinity: &apiv1.PodAffinity{}}
+		affinity = buildDeploymentObject("testNamespace", app).Spec.Template.Spec.Affinity
+		assert.Nil(t, affinity.NodeAffinity)
+		assert.NotNil(t, affinity.PodAffinity)
+		assert.Len(t, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+		assert.Nil(t, app.Affinity.PodAntiAffinity)
+	})
+
+	t.Run("Probes", func(t *testing.T) {
+		app := testApp
+		app.ReadinessProbe = &apiv1.Probe{
+			Handler: apiv1.Handler{
+				HTTPGet: &apiv1.HTTPGetAction{Path: "/healthz"},
+			},
+			FailureThreshold: 1,
+		}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		container := obj.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, "/healthz", container.ReadinessProbe.HTTPGet.Path)
+		assert.Nil(t, container.LivenessProbe)
+	})
+
+	t.Run("Sidecar options", func(t *testing.T) {
+		logAsJSON := true
+		maxConcurrency := 1
+		app := testApp
+		app.DaprEnabled = true
+		app.DaprCPULimit = "1"
+		app.SidecarOptions = SidecarOptions{
+			CPULimit:          "500m",
+			LogLevel:          "debug",
+			LogAsJSON:         &logAsJSON,
+			AppMaxConcurrency: &maxConcurrency,
+		}
+
+		// act
+		obj := buildDeploymentObject("testNamespace", app)
+
+		// assert
+		annotations := obj.Spec.Template.Annotations
+		assert.Equal(t, "500m", annotations["dapr.io/sidecar-cpu-limit"])
+		assert.Equal(t, "debug", annotations["dapr.io/log-level"])
+		assert.Equal(t, "true", annotations["dapr.io/log-as-json"])
+		assert.Equal(t, "1", annotations["dapr.io/app-max-concurrency"])
+		assert.NotContains(t, annotations, "dapr.io/enable-profiling")
+		assert.NotContains(t, annotations, "dapr.io/http-max-request-size")
+	})
+
+	t.Run("Dapr app ID defaults to app name", func(t *testing.T) {
+		testApp.DaprEnabled = true
+
+		// act
+		obj := buildDeploymentObject("testNamespace", testApp)
+
+		// assert
+		assert.Equal(t, testApp.AppName, obj.Spec.Template.Annotations["dapr.io/app-id"])
+	})
+
+	t.Run("Dapr app ID override", func(t *testing.T) {
+		testApp.DaprEnabled = true
+		testApp.AppID = "custom-app-id"
+		defer func() { testApp.AppID = "" }()
+
+		// act
+		obj := buildDeploymentObject("testNamespace", testApp)
+
+		// assert
+		assert.Equal(t, "custom-app-id", obj.Spec.Template.Annotations["dapr.io/app-id"])
+		assert.Equal(t, testApp.AppName, obj.ObjectMeta.Name)
+	})
+
 	t.Run("Dapr disabled", func(t *testing.T) {
 		testApp.DaprEnabled = false
 
@@ -78,4 +371,153 @@ func TestBuildServiceObject(t *testing.T) {
 		assert.NotNil(t, obj)
 		assert.Equal(t, apiv1.ServiceTypeClusterIP, obj.Spec.Type)
 	})
+
+	t.Run("Extra ports", func(t *testing.T) {
+		testApp.ExtraPorts = []int{9090, 50001}
+
+		// act
+		obj := buildServiceObject("testNamespace", testApp)
+		deployment := buildDeploymentObject("testNamespace", testApp)
+
+		// assert
+		assert.Len(t, obj.Spec.Ports, 3)
+		assert.Equal(t, "http", obj.Spec.Ports[0].Name)
+		assert.Equal(t, int32(DefaultExternalPort), obj.Spec.Ports[0].Port)
+		assert.Equal(t, "port-9090", obj.Spec.Ports[1].Name)
+		assert.Equal(t, int32(9090), obj.Spec.Ports[1].Port)
+		assert.Equal(t, int32(50001), obj.Spec.Ports[2].TargetPort.IntVal)
+
+		containerPorts := deployment.Spec.Template.Spec.Containers[0].Ports
+		assert.Len(t, containerPorts, 3)
+		assert.Equal(t, int32(50001), containerPorts[2].ContainerPort)
+	})
+
+	t.Run("Explicit ports", func(t *testing.T) {
+		testApp.ExtraPorts = []int{9090}
+		testApp.Ports = []AppPort{
+			{Name: "grpc", ContainerPort: 50051},
+			{ContainerPort: 8080},
+			{ContainerPort: 5353, Protocol: apiv1.ProtocolUDP},
+		}
+
+		// act
+		obj := buildServiceObject("testNamespace", testApp)
+		deployment := buildDeploymentObject("testNamespace", testApp)
+
+		// assert
+		assert.Equal(t, []apiv1.ServicePort{
+			{Name: "grpc", Protocol: apiv1.ProtocolTCP, Port: 50051, TargetPort: intstr.FromInt(50051)},
+			{Name: "port-8080", Protocol: apiv1.ProtocolTCP, Port: 8080, TargetPort: intstr.FromInt(8080)},
+			{Name: "udp-5353", Protocol: apiv1.ProtocolUDP, Port: 5353, TargetPort: intstr.FromInt(5353)},
+		}, obj.Spec.Ports)
+		assert.Equal(t, []apiv1.ContainerPort{
+			{Name: "grpc", Protocol: apiv1.ProtocolTCP, ContainerPort: 50051},
+			{Name: "port-8080", Protocol: apiv1.ProtocolTCP, ContainerPort: 8080},
+			{Name: "udp-5353", Protocol: apiv1.ProtocolUDP, ContainerPort: 5353},
+		}, deployment.Spec.Template.Spec.Containers[0].Ports)
+	})
+}
+
+func TestBuildStatefulSetObject(t *testing.T) {
+	testApp := AppDescription{
+		AppName:      "testapp",
+		DaprEnabled:  true,
+		ImageName:    "helloworld",
+		RegistryName: "dariotest",
+		Replicas:     3,
+		WorkloadType: WorkloadTypeStatefulSet,
+	}
+
+	// act
+	obj := buildStatefulSetObject("testNamespace", testApp)
+
+	// assert
+	assert.NotNil(t, obj)
+	assert.Equal(t, "testapp", obj.Name)
+	assert.Equal(t, int32(3), *obj.Spec.Replicas)
+	assert.Equal(t, "testapp", obj.Spec.ServiceName)
+	assert.Equal(t, "testapp", obj.Spec.Selector.MatchLabels[TestAppLabelKey])
+	assert.Equal(t, "true", obj.Spec.Template.Annotations["dapr.io/enabled"])
+	assert.Equal(t, "dariotest/helloworld", obj.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestBuildJobObject(t *testing.T) {
+	testApp := AppDescription{
+		AppName:      "testapp",
+		DaprEnabled:  true,
+		ImageName:    "helloworld",
+		RegistryName: "dariotest",
+		Replicas:     2,
+		WorkloadType: WorkloadTypeJob,
+	}
+
+	// act
+	obj := buildJobObject("testNamespace", testApp)
+
+	// assert
+	assert.NotNil(t, obj)
+	assert.Equal(t, "testapp", obj.Name)
+	assert.Equal(t, int32(2), *obj.Spec.Parallelism)
+	assert.Equal(t, int32(2), *obj.Spec.Completions)
+	assert.Equal(t, int32(0), *obj.Spec.BackoffLimit)
+	assert.Equal(t, apiv1.RestartPolicyNever, obj.Spec.Template.Spec.RestartPolicy)
+	assert.Equal(t, "testapp", obj.Spec.Template.Labels[TestAppLabelKey])
+	assert.Equal(t, "true", obj.Spec.Template.Annotations["dapr.io/enabled"])
+}
+
+func TestBuildNamespaceObject(t *testing.T) {
+	obj := buildNamespaceObject("testNamespace")
+
+	assert.Equal(t, "testNamespace", obj.Name)
+	assert.Equal(t, "true", obj.Labels[TestNamespaceLabelKey])
+	assert.Equal(t, TestRunID, obj.Labels[TestRunIDLabelKey])
+}
+
+func TestNewAppDescription(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		app, err := NewAppDescription("testapp", WithImage("dapriotest", "helloworld"))
+		assert.NoError(t, err)
+		assert.Equal(t, AppDescription{
+			AppName:      "testapp",
+			DaprEnabled:  true,
+			Replicas:     1,
+			RegistryName: "dapriotest",
+			ImageName:    "helloworld",
+		}, app)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		app, err := NewAppDescription("testapp",
+			WithImage("dapriotest", "helloworld"),
+			WithAppID("hello"),
+			WithAppPort(3000, "grpc"),
+			WithReplicas(3),
+			WithIngress(),
+			WithAppEnv("KEY", "value"),
+			WithPodAnnotation("dapr.io/log-level", "debug"),
+		)
+		assert.NoError(t, err)
+
+		obj := buildDeploymentObject("testNamespace", app)
+		assert.Equal(t, int32(3), *obj.Spec.Replicas)
+		assert.Equal(t, "hello", obj.Spec.Template.Annotations["dapr.io/app-id"])
+		assert.Equal(t, "3000", obj.Spec.Template.Annotations["dapr.io/app-port"])
+		assert.Equal(t, "debug", obj.Spec.Template.Annotations["dapr.io/log-level"])
+		assert.Equal(t, apiv1.ServiceTypeLoadBalancer, buildServiceObject("testNamespace", app).Spec.Type)
+		assert.Equal(t, map[string]string{"KEY": "value"}, app.AppEnv)
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		_, err := NewAppDescription("testapp")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid app ID", func(t *testing.T) {
+		_, err := NewAppDescription("testapp", WithImage("dapriotest", "helloworld"), WithAppID("hello.world"))
+		assert.Error(t, err)
+
+		// The app ID isn't used without dapr
+		_, err = NewAppDescription("testapp", WithImage("dapriotest", "helloworld"), WithAppID("hello.world"), WithoutDapr())
+		assert.NoError(t, err)
+	})
 }
@@ -1,15 +1,21 @@
 package kubernetes
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
+	"syscall"
 
 	"github.com/phayes/freeport"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
@@ -22,10 +28,30 @@ type PodPortForwarder struct {
 	client *KubeClient
 	// Kubernetes namespace
 	namespace string
+	// sessions holds the active port forwards by pod name
+	sessions map[string][]*portForwardSession
+	// lock guards sessions
+	lock sync.Mutex
+}
+
+// portForwardSession is a single port forward to a pod
+type portForwardSession struct {
+	// localPorts are the local ports forwarded to the pod
+	localPorts []int
+	// podPorts are the pod ports the local ports are forwarded to
+	podPorts []int
 	// stopChannel is the channel used to manage the port forward lifecycle
 	stopChannel chan struct{}
-	// readyChannel communicates when the tunnel is ready to receive traffic
-	readyChannel chan struct{}
+	// udpRelay is the local UDP socket relaying datagrams over the port forward, if any
+	udpRelay net.PacketConn
+}
+
+// close stops the port forward and the UDP relay
+func (s *portForwardSession) close() {
+	close(s.stopChannel)
+	if s.udpRelay != nil {
+		s.udpRelay.Close()
+	}
 }
 
 // PortForwardRequest encapsulates data required to establish a Kuberentes tunnel
@@ -44,20 +70,173 @@ type PortForwardRequest struct {
 	stopChannel chan struct{}
 	// stopChannel communicates when the tunnel is ready to receive traffic
 	readyChannel chan struct{}
+	// errChannel receives the error if the tunnel fails, e.g. because no local port could be bound
+	errChannel chan error
 }
 
 // NewPodPortForwarder returns a new PodPortForwarder
 func NewPodPortForwarder(c *KubeClient, namespace string) *PodPortForwarder {
 	return &PodPortForwarder{
-		client:       c,
-		namespace:    namespace,
-		readyChannel: make(chan struct{}),
-		stopChannel:  make(chan struct{}),
+		client:    c,
+		namespace: namespace,
+		sessions:  map[string][]*portForwardSession{},
 	}
 }
 
 // Connect establishes a new connection to a given app on the provided target ports
 func (p *PodPortForwarder) Connect(name string, targetPorts ...int) ([]int, error) {
+	session, err := p.connect(name, nil, targetPorts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.localPorts, nil
+}
+
+// ConnectUDP forwards a local UDP port to a pod. Port forwarding only supports TCP, so the datagrams are
+// written to a port forward to relayPort, where a relay in the pod such as socat sends them to the UDP port.
+// Replies are sent back to the local address which sent the last datagram.
+// The TCP stream doesn't preserve datagram boundaries, so only one datagram may be in flight at a time: callers
+// must wait for the reply, or give up on it, before sending the next one. Datagrams sent back to back may
+// otherwise arrive merged or split.
+func (p *PodPortForwarder) ConnectUDP(name string, relayPort int) (int, error) {
+	session, err := p.connect(name, nil, relayPort)
+	if err != nil {
+		return 0, err
+	}
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		p.lock.Lock()
+		p.removeSession(name, session)
+		p.lock.Unlock()
+		return 0, err
+	}
+
+	p.lock.Lock()
+	session.udpRelay = udpConn
+	tcpAddr := fmt.Sprintf("127.0.0.1:%d", session.localPorts[0])
+	udpPort := udpConn.LocalAddr().(*net.UDPAddr).Port
+	session.localPorts = []int{udpPort}
+	p.lock.Unlock()
+
+	go relayUDP(udpConn, tcpAddr)
+
+	return udpPort, nil
+}
+
+// relayUDP writes the datagrams received on udpConn to a TCP connection to tcpAddr and sends the data
+// read from it back to the last sender, until udpConn is closed. There is no framing, each read from the
+// TCP connection is sent as one datagram.
+func relayUDP(udpConn net.PacketConn, tcpAddr string) {
+	var (
+		lock    sync.Mutex
+		tcpConn net.Conn
+		sender  net.Addr
+	)
+
+	defer func() {
+		lock.Lock()
+		if tcpConn != nil {
+			tcpConn.Close()
+		}
+		lock.Unlock()
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := udpConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		lock.Lock()
+		sender = addr
+		if tcpConn == nil {
+			tcpConn, err = net.Dial("tcp", tcpAddr)
+			if err != nil {
+				lock.Unlock()
+				log.Printf("Failed to connect UDP relay to %s: %s", tcpAddr, err)
+				continue
+			}
+			go func(conn net.Conn) {
+				reply := make([]byte, 64*1024)
+				for {
+					n, err := conn.Read(reply)
+					if err != nil {
+						return
+					}
+					lock.Lock()
+					to := sender
+					lock.Unlock()
+					udpConn.WriteTo(reply[:n], to)
+				}
+			}(tcpConn)
+		}
+		conn := tcpConn
+		lock.Unlock()
+
+		if _, err := conn.Write(buf[:n]); err != nil {
+			log.Printf("Failed to relay UDP datagram to %s: %s", tcpAddr, err)
+			lock.Lock()
+			conn.Close()
+			tcpConn = nil
+			lock.Unlock()
+		}
+	}
+}
+
+// removeSession drops a session of the given pod, the lock must be held
+func (p *PodPortForwarder) removeSession(name string, session *portForwardSession) {
+	session.close()
+
+	sessions := p.sessions[name]
+	for i, s := range sessions {
+		if s == session {
+			sessions = append(sessions[:i], sessions[i+1:]...)
+			break
+		}
+	}
+	if len(sessions) == 0 {
+		delete(p.sessions, name)
+	} else {
+		p.sessions[name] = sessions
+	}
+}
+
+// portForward describes an active TCP port forward so it can be established again
+type portForward struct {
+	podName    string
+	localPorts []int
+	podPorts   []int
+}
+
+// tcpForwards returns the active TCP port forwards, UDP relays are left out
+func (p *PodPortForwarder) tcpForwards() []portForward {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	forwards := []portForward{}
+	for name, sessions := range p.sessions {
+		for _, session := range sessions {
+			if session.udpRelay == nil {
+				forwards = append(forwards, portForward{podName: name, localPorts: session.localPorts, podPorts: session.podPorts})
+			}
+		}
+	}
+
+	return forwards
+}
+
+// reconnect forwards the same local ports as a closed port forward to the given pod
+func (p *PodPortForwarder) reconnect(name string, forward portForward) error {
+	_, err := p.connect(name, forward.localPorts, forward.podPorts...)
+	return err
+}
+
+// connect establishes a port forward to the given pod and registers its session.
+// Free local ports are picked if localPorts is nil.
+func (p *PodPortForwarder) connect(name string, localPorts []int, targetPorts ...int) (*portForwardSession, error) {
 	if name == "" {
 		return nil, fmt.Errorf("name must be set to establish connection")
 	}
@@ -73,8 +252,8 @@ func (p *PodPortForwarder) Connect(name string, targetPorts ...int) ([]int, erro
 
 	config := p.client.GetClientConfig()
 
-	var ports []int
-	for i := 0; i < len(targetPorts); i++ {
+	ports := append([]int{}, localPorts...)
+	for i := len(ports); i < len(targetPorts); i++ {
 		p, perr := freeport.GetFreePort()
 		if perr != nil {
 			return nil, perr
@@ -88,34 +267,221 @@ func (p *PodPortForwarder) Connect(name string, targetPorts ...int) ([]int, erro
 		ErrOut: os.Stderr,
 	}
 
-	err := startPortForwarding(PortForwardRequest{
-		restConfig: config,
-		pod: apiv1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
-				Namespace: p.namespace,
+	var stopChannel chan struct{}
+	for attempt := 1; ; attempt++ {
+		remapped, err := remapUsedLocalPorts(name, ports, targetPorts)
+		if err != nil {
+			return nil, err
+		}
+
+		stopChannel = make(chan struct{})
+		readyChannel := make(chan struct{})
+		errChannel := make(chan error, 1)
+
+		err = startPortForwarding(PortForwardRequest{
+			restConfig: config,
+			pod: apiv1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: p.namespace,
+				},
 			},
-		},
-		localPorts:   ports,
-		podPorts:     targetPorts,
-		streams:      streams,
-		stopChannel:  p.stopChannel,
-		readyChannel: p.readyChannel,
+			localPorts:   ports,
+			podPorts:     targetPorts,
+			streams:      streams,
+			stopChannel:  stopChannel,
+			readyChannel: readyChannel,
+			errChannel:   errChannel,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-readyChannel:
+		case err = <-errChannel:
+		}
+		if err == nil {
+			break
+		}
+		// A local port may be taken between the check and the forward, so the ports are checked again
+		if attempt >= maxPortForwardAttempts || !remapped && !anyLocalPortUsed(ports) {
+			return nil, fmt.Errorf("failed to forward ports %v of pod %s: %w", targetPorts, name, err)
+		}
+	}
+
+	session := &portForwardSession{
+		localPorts:  ports,
+		podPorts:    targetPorts,
+		stopChannel: stopChannel,
+	}
+
+	p.lock.Lock()
+	p.sessions[name] = append(p.sessions[name], session)
+	p.lock.Unlock()
+
+	return session, nil
+}
+
+// maxPortForwardAttempts is how many times a port forward is attempted when local ports are taken
+const maxPortForwardAttempts = 3
+
+// remapUsedLocalPorts replaces the local ports in ports which are already in use with free ports
+// and reports whether any port was replaced. The remapped ports are logged.
+func remapUsedLocalPorts(name string, ports, podPorts []int) (bool, error) {
+	remapped := false
+	for i, port := range ports {
+		if !localPortUsed(port) {
+			continue
+		}
+
+		free, err := freeport.GetFreePort()
+		if err != nil {
+			return remapped, err
+		}
+		log.Printf("Local port %d is in use, forwarding port %d of pod %s from local port %d instead", port, podPorts[i], name, free)
+		ports[i] = free
+		remapped = true
+	}
+
+	return remapped, nil
+}
+
+// anyLocalPortUsed returns true if any of the local ports is in use
+func anyLocalPortUsed(ports []int) bool {
+	for _, port := range ports {
+		if localPortUsed(port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localPortUsed returns true if binding the local port fails with EADDRINUSE
+func localPortUsed(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return errors.Is(err, syscall.EADDRINUSE)
+	}
+	listener.Close()
+
+	return false
+}
+
+// ConnectToService establishes a new connection to a ready pod behind the given service, like
+// `kubectl port-forward svc/name`. targetPorts are service ports, which are mapped to the pod's target ports.
+func (p *PodPortForwarder) ConnectToService(name string, targetPorts ...int) ([]int, error) {
+	if p.client == nil {
+		return nil, fmt.Errorf("client must be set to establish connection")
+	}
+
+	svc, err := p.client.Services(p.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(svc.Spec.Selector) == 0 {
+		return nil, fmt.Errorf("service %s has no selector", name)
+	}
+
+	podList, err := p.client.Pods(p.namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	podName, podPorts, err := servicePodTarget(svc, podList.Items, targetPorts)
 	if err != nil {
 		return nil, err
 	}
 
-	<-p.readyChannel
+	return p.Connect(podName, podPorts...)
+}
+
+// servicePodTarget picks the first ready pod of the service and maps the service ports to its target ports
+func servicePodTarget(svc *apiv1.Service, pods []apiv1.Pod, servicePorts []int) (string, []int, error) {
+	podPorts := make([]int, 0, len(servicePorts))
+	for _, servicePort := range servicePorts {
+		found := false
+		for _, port := range svc.Spec.Ports {
+			if int(port.Port) != servicePort {
+				continue
+			}
+			// Named target ports are not resolved, fall back to the service port
+			targetPort := int(port.TargetPort.IntVal)
+			if targetPort == 0 {
+				targetPort = servicePort
+			}
+			podPorts = append(podPorts, targetPort)
+			found = true
+			break
+		}
+		if !found {
+			return "", nil, fmt.Errorf("service %s doesn't expose port %d", svc.Name, servicePort)
+		}
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase != apiv1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == apiv1.PodReady && condition.Status == apiv1.ConditionTrue {
+				return pod.Name, podPorts, nil
+			}
+		}
+	}
 
-	return ports, nil
+	return "", nil, fmt.Errorf("no ready pods found for service %s", svc.Name)
 }
 
+// Stop closes all port forwards to the given pod
+func (p *PodPortForwarder) Stop(name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	sessions, ok := p.sessions[name]
+	if !ok {
+		return fmt.Errorf("no active port forwarding to pod %s", name)
+	}
+
+	for _, session := range sessions {
+		session.close()
+	}
+	delete(p.sessions, name)
+
+	return nil
+}
+
+// ActiveForwards returns the local ports of the active port forwards by pod name
+func (p *PodPortForwarder) ActiveForwards() map[string][]int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	forwards := make(map[string][]int, len(p.sessions))
+	for name, sessions := range p.sessions {
+		for _, session := range sessions {
+			forwards[name] = append(forwards[name], session.localPorts...)
+		}
+	}
+
+	return forwards
+}
+
+// Close closes all port forwards
 func (p *PodPortForwarder) Close() error {
-	if p.stopChannel != nil {
-		close(p.stopChannel)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, sessions := range p.sessions {
+		for _, session := range sessions {
+			session.close()
+		}
 	}
+	p.sessions = map[string][]*portForwardSession{}
+
 	return nil
 }
 
@@ -145,7 +511,9 @@ func startPortForwarding(req PortForwardRequest) error {
 	go func() {
 		if err = fw.ForwardPorts(); err != nil {
 			log.Printf("Error closing port fowarding: %+v", err)
-			// TODO: How to handle error?
+			if req.errChannel != nil {
+				req.errChannel <- err
+			}
 		}
 		log.Println("Closed port fowarding")
 	}()
@@ -6,6 +6,7 @@
 package runner
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -240,13 +241,7 @@ func (c *KubeTestPlatform) Scale(name string, replicas int32) error {
 	app := c.AppResources.FindActiveResource(name)
 	appManager := app.(*kube.AppManager)
 
-	if err := appManager.ScaleDeploymentReplica(replicas); err != nil {
-		return err
-	}
-
-	_, err := appManager.WaitUntilDeploymentState(appManager.IsDeploymentDone)
-
-	return err
+	return appManager.ScaleDeploymentReplica(replicas)
 }
 
 // Restart restarts all instances for the app.
@@ -267,8 +262,7 @@ func (c *KubeTestPlatform) PortForwardToApp(appName string, targetPorts ...int)
 	app := c.AppResources.FindActiveResource(appName)
 	appManager := app.(*kube.AppManager)
 
-	_, err := appManager.WaitUntilDeploymentState(appManager.IsDeploymentDone)
-	if err != nil {
+	if err := appManager.WaitUntilWorkloadReady(context.Background()); err != nil {
 		return nil, err
 	}
 